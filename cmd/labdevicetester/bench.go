@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// bench is a set of devices tested at the same time, e.g. to compare an N2
+// and an R4 under the same network conditions
+type bench struct {
+	Devices []benchDevice `json:"devices"`
+}
+
+// benchDevice is a device on the bench
+type benchDevice struct {
+	// Name is used for the output directory and log prefix, default is the
+	// type
+	Name   string `json:"name,omitempty"`
+	Device string `json:"device"`
+	Type   string `json:"type"`
+	// Arc is the Otii Arc measuring the device, see -arc. Devices without
+	// one are tested without the Otii.
+	Arc string `json:"arc,omitempty"`
+	// Args are extra flags for this device, e.g. ["-rat", "nb-iot"]
+	Args []string `json:"args,omitempty"`
+}
+
+func loadBench(filename string) (bench, error) {
+	var b bench
+	f, err := os.Open(filename)
+	if err != nil {
+		return b, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&b); err != nil {
+		return b, err
+	}
+	if len(b.Devices) == 0 {
+		return b, errors.New("bench has no devices")
+	}
+	names := make(map[string]bool)
+	for i := range b.Devices {
+		d := &b.Devices[i]
+		if d.Device == "" || d.Type == "" {
+			return b, fmt.Errorf("device %d: missing device or type", i+1)
+		}
+		if d.Name == "" {
+			d.Name = d.Type
+		}
+		if names[d.Name] {
+			return b, fmt.Errorf("device %d: duplicate name %q", i+1, d.Name)
+		}
+		names[d.Name] = true
+	}
+	return b, nil
+}
+
+// pathFlags are the flags taking input file names, which are made absolute
+// since each device runs in its own directory. The scenario and battery
+// flags are only file names if the file exists. Outputs like -junit are left
+// relative to the device directory.
+var pathFlags = map[string]bool{
+	"plan": true, "sweep": true, "otiicli": true, "scenario": true, "battery": true,
+}
+
+// apnPasswordEnv is the environment variable -apnpassword is passed to the
+// devices in, so that it isn't shown in their command lines
+const apnPasswordEnv = "LABDEVICETESTER_APN_PASSWORD"
+
+// benchFlags are the flags given to every device: the flags set on the
+// command line except those set per device and the APN password
+func benchFlags() []string {
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "bench", "device", "type", "arc", "apnpassword":
+			return
+		}
+		value := f.Value.String()
+		if pathFlags[f.Name] {
+			if _, err := os.Stat(value); err == nil || (f.Name != "scenario" && f.Name != "battery") {
+				if abs, err := filepath.Abs(value); err == nil {
+					value = abs
+				}
+			}
+		}
+		args = append(args, "-"+f.Name+"="+value)
+	})
+	return args
+}
+
+// runBench runs this program for every device on the bench at the same time,
+// each in its own directory under captures/bench-<time> with its own log,
+// captures and results, and compares the results when they're all done. The
+// exit code is that of the first device that failed.
+func runBench(filename string) int {
+	b, err := loadBench(filename)
+	if err != nil {
+		log.Print("Error reading bench: ", err)
+		return exitConfig
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		log.Print("Error locating executable: ", err)
+		return exitConfig
+	}
+
+	dir := "captures/bench-" + time.Now().Format("20060102T150405")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Print("Error creating bench directory: ", err)
+		return exitConfig
+	}
+	logFile, err := os.OpenFile(filepath.Join(dir, "bench.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Print("Unable to open log file:", err)
+		return exitConfig
+	}
+	defer logFile.Close()
+	log.SetOutput(io.MultiWriter(os.Stdout, logFile))
+	log.SetFlags(log.Ltime | log.Lmicroseconds)
+
+	// Ctrl-C reaches the devices directly since they're in the same process
+	// group, so it's only noted here while they stop
+	interrupts := make(chan os.Signal, 2)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		for range interrupts {
+			log.Println("Interrupted, waiting for the devices to stop...")
+		}
+	}()
+
+	common := benchFlags()
+	codes := make([]int, len(b.Devices))
+	var wg sync.WaitGroup
+	// The devices already started are stopped if one can't be
+	var started []*exec.Cmd
+	abort := func() int {
+		for _, cmd := range started {
+			cmd.Process.Kill()
+		}
+		wg.Wait()
+		return exitConfig
+	}
+	for i, d := range b.Devices {
+		deviceDir := filepath.Join(dir, d.Name)
+		if err := os.MkdirAll(filepath.Join(deviceDir, "captures"), 0755); err != nil {
+			log.Print("Error creating device directory: ", err)
+			return abort()
+		}
+		args := append([]string{}, common...)
+		args = append(args, "-device="+d.Device, "-type="+d.Type)
+		if d.Arc != "" {
+			args = append(args, "-arc="+d.Arc)
+		} else {
+			args = append(args, "-otii=false")
+		}
+		args = append(args, d.Args...)
+
+		cmd := exec.Command(executable, args...)
+		cmd.Dir = deviceDir
+		if password := flag.Lookup("apnpassword").Value.String(); password != "" {
+			cmd.Env = append(os.Environ(), apnPasswordEnv+"="+password)
+		}
+		output := &prefixWriter{prefix: "[" + d.Name + "] ", w: os.Stdout}
+		cmd.Stdout = output
+		cmd.Stderr = output
+		log.Printf("Starting %s on %s", d.Name, d.Device)
+		if err := cmd.Start(); err != nil {
+			log.Print("Error starting ", d.Name, ": ", err)
+			return abort()
+		}
+		started = append(started, cmd)
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// The exit code is all that matters, any error is in the log
+			cmd.Wait()
+			output.flush()
+			codes[i] = cmd.ProcessState.ExitCode()
+			if codes[i] < 0 {
+				// Killed by a signal
+				codes[i] = exitFailed
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var rows []comparisonRow
+	code := exitOK
+	for i, d := range b.Devices {
+		log.Printf("%s exited with %d", d.Name, codes[i])
+		if codes[i] == exitInterrupted || (code == exitOK && codes[i] != exitOK) {
+			code = codes[i]
+		}
+		results := benchResults(filepath.Join(dir, d.Name, "captures"))
+		if len(results) > 0 {
+			rows = append(rows, comparisonRow{Name: d.Name, Parameters: d.Type + " " + results[0].Scenario, Summary: summarizeRuns(results)})
+		}
+	}
+	if len(rows) > 0 {
+		writeComparison(filepath.Join(dir, "bench.csv"), rows)
+	}
+	if code != exitOK {
+		reportError()
+		return code
+	}
+	log.Println("Success!")
+	return exitOK
+}
+
+// prefixWriter writes the lines written to it to w with a prefix. A partial
+// line is kept until it's completed or flushed.
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := fmt.Fprintf(p.w, "%s%s", p.prefix, p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// flush writes the partial line, if any
+func (p *prefixWriter) flush() {
+	if len(p.buf) > 0 {
+		fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.buf)
+		p.buf = nil
+	}
+}
+
+// benchResults reads the results written by a device, in the order they were
+// run
+func benchResults(dir string) []*runResult {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil
+	}
+	var results []*runResult
+	for _, filename := range files {
+		buf, err := ioutil.ReadFile(filename)
+		if err != nil {
+			log.Println("Error reading result:", err)
+			continue
+		}
+		r := &runResult{filename: filename}
+		// Summaries are JSON too, but have no status
+		if err := json.Unmarshal(buf, r); err != nil || r.Status == "" {
+			continue
+		}
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Start.Before(results[j].Start) })
+	return results
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	p := &prefixWriter{prefix: "[n2] ", w: &out}
+	// Lines split across writes and longer than a scanner buffer
+	long := strings.Repeat("x", 100000)
+	for _, s := range []string{"first\nsec", "ond\n", "", long, "\nlast"} {
+		if n, err := p.Write([]byte(s)); n != len(s) || err != nil {
+			t.Fatalf("Write() = %d, %v", n, err)
+		}
+	}
+	want := "[n2] first\n[n2] second\n[n2] " + long + "\n"
+	if out.String() != want {
+		t.Errorf("output %.40q, want %.40q", out.String(), want)
+	}
+	p.flush()
+	want += "[n2] last\n"
+	if out.String() != want {
+		t.Errorf("flushed output ends %q", out.String()[len(out.String())-20:])
+	}
+	p.flush()
+	if out.String() != want {
+		t.Error("second flush wrote more")
+	}
+}
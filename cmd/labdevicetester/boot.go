@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/devicefamily"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/otii"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/otii/capture"
+)
+
+// bootResult is the outcome of a cold boot
+type bootResult struct {
+	Capture string `json:"capture"`
+	// TimeToURC and TimeToFirstAT are the seconds from power on
+	TimeToURC     float64 `json:"time_to_urc_s"`
+	TimeToFirstAT float64 `json:"time_to_first_at_s"`
+	// Energy is from power on to the first AT response
+	Energy float64 `json:"energy_j"`
+	Charge float64 `json:"charge_mah"`
+}
+
+// coldBoot powers the device off and on again with the Otii while recording,
+// and waits for it to boot
+func (r *runResult) coldBoot(d devicefamily.Interface, m otii.Measurement, duration time.Duration, analyze bool) error {
+	log.Println("Cold boot")
+	if err := otii.DisableMainPower(); err != nil {
+		log.Println("Error disabling main power:", err)
+		return exitError{exitOtii, err}
+	}
+	// Let the capacitors on the board discharge
+	time.Sleep(2 * time.Second)
+
+	r.Boot = &bootResult{Capture: m.CaptureFilename(map[string]string{"type": r.DeviceType, "scenario": "boot"})}
+	powerOn := time.Now()
+	recording := make(chan error, 1)
+	go func() {
+		recording <- otii.RecordPowerOn(m, duration, r.Boot.Capture)
+	}()
+
+	boot, err := d.WaitForBoot()
+	if err != nil {
+		<-recording
+		return exitError{exitDevice, fmt.Errorf("device not responding after boot: %v", err)}
+	}
+	if err := <-recording; err != nil {
+		log.Println("Error recording boot:", err)
+		return exitError{exitOtii, err}
+	}
+
+	if analyze {
+		c, err := capture.Open(r.Boot.Capture)
+		if err != nil {
+			log.Println("Error opening boot capture:", err)
+			return exitError{exitOtii, err}
+		}
+		// Main power is turned on right after the recording starts, which is
+		// a better estimate of power on than the host time since otiicli
+		// takes a while to start
+		if len(c.Recordings) > 0 {
+			powerOn = c.Recordings[0].Start
+		}
+		m, err := c.MetricsBetween(powerOn, boot.FirstAT.Round(0), 0)
+		if err != nil {
+			log.Println("Error computing boot metrics:", err)
+			return exitError{exitOtii, err}
+		}
+		r.Boot.Energy = m.Energy
+		r.Boot.Charge = m.Charge
+	}
+
+	if !boot.URC.IsZero() {
+		r.Boot.TimeToURC = boot.URC.Round(0).Sub(powerOn).Seconds()
+	}
+	r.Boot.TimeToFirstAT = boot.FirstAT.Round(0).Sub(powerOn).Seconds()
+	log.Printf("Boot: URC after %.3f s, first AT response after %.3f s, %.4f J, %.5f mAh",
+		r.Boot.TimeToURC, r.Boot.TimeToFirstAT, r.Boot.Energy, r.Boot.Charge)
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/stats"
+)
+
+// comparisonRow is the summary of the runs of one sweep variant or bench
+// device
+type comparisonRow struct {
+	Name       string
+	Parameters string
+	Summary    repeatSummary
+}
+
+// cheapest returns the index of the row with the lowest mean recording
+// energy per packet, or -1 if no row has any
+func cheapest(rows []comparisonRow) int {
+	best := -1
+	for i, row := range rows {
+		e := row.Summary.RecordingEnergyPerPacket
+		if e.N > 0 && (best < 0 || e.Mean < rows[best].Summary.RecordingEnergyPerPacket.Mean) {
+			best = i
+		}
+	}
+	return best
+}
+
+// writeComparison logs a table comparing the rows and writes it as CSV to
+// filename
+func writeComparison(filename string, rows []comparisonRow) {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Name\tParameters\tPassed\tRecording energy/packet (J)\tRegistration (s)\tRound trip (s)")
+	for _, row := range rows {
+		s := row.Summary
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\t%s\t%s\t%s\n", row.Name, row.Parameters, s.Passed, s.Runs,
+			meanCI(s.RecordingEnergyPerPacket, "%.4f"), meanCI(s.RegistrationTime, "%.2f"), meanCI(s.RoundTripTime, "%.3f"))
+	}
+	w.Flush()
+	log.Println("Comparison:")
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		log.Println(line)
+	}
+	if best := cheapest(rows); best >= 0 {
+		log.Printf("Cheapest: %s (%s)", rows[best].Name, rows[best].Parameters)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Println("Error writing comparison:", err)
+		return
+	}
+	defer f.Close()
+	c := csv.NewWriter(f)
+	c.Write([]string{"name", "parameters", "runs", "passed",
+		"recording_energy_per_packet_j", "recording_energy_per_packet_j_ci95_low", "recording_energy_per_packet_j_ci95_high",
+		"registration_time_s", "round_trip_time_s", "results"})
+	for _, row := range rows {
+		s := row.Summary
+		c.Write([]string{row.Name, row.Parameters, fmt.Sprint(s.Runs), fmt.Sprint(s.Passed),
+			value(s.RecordingEnergyPerPacket, s.RecordingEnergyPerPacket.Mean), value(s.RecordingEnergyPerPacket, s.RecordingEnergyPerPacket.CILow), value(s.RecordingEnergyPerPacket, s.RecordingEnergyPerPacket.CIHigh),
+			value(s.RegistrationTime, s.RegistrationTime.Mean), value(s.RoundTripTime, s.RoundTripTime.Mean),
+			strings.Join(s.Results, " ")})
+	}
+	c.Flush()
+	if err := c.Error(); err != nil {
+		log.Println("Error writing comparison:", err)
+		return
+	}
+	log.Println("Comparison written to", filename)
+}
+
+// meanCI formats the mean of s, with the confidence interval if there's more
+// than one value, or "-" if there are none
+func meanCI(s stats.Summary, format string) string {
+	switch s.N {
+	case 0:
+		return "-"
+	case 1:
+		return fmt.Sprintf(format, s.Mean)
+	}
+	return fmt.Sprintf(format+" ± "+format, s.Mean, s.CIHigh-s.Mean)
+}
+
+// value formats v for the CSV, empty if s has no values
+func value(s stats.Summary, v float64) string {
+	if s.N == 0 {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
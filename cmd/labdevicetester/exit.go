@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// Exit codes
+const (
+	exitOK = 0
+	// exitFailed is a test failure, e.g. a failed send or assert
+	exitFailed = 1
+	// exitConfig is an invalid flag, plan or scenario. The flag package
+	// also exits with 2 on invalid flags.
+	exitConfig = 2
+	// exitDevice is a device that doesn't respond on the serial port, or
+	// doesn't register in time
+	exitDevice = 3
+	// exitOtii is a failure controlling or recording with the Otii
+	exitOtii = 4
+	// exitInterrupted is a run stopped with SIGINT, 128 + the signal number
+	// like the shells do
+	exitInterrupted = 130
+)
+
+// exitError is an error with the exit code it causes
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
+// exitCode returns the exit code of an error, exitFailed unless it's an
+// exitError or the run was interrupted
+func exitCode(err error) int {
+	if errors.Is(err, context.Canceled) {
+		return exitInterrupted
+	}
+	var e exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitFailed
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errors.New("send failed"), exitFailed},
+		{exitError{exitDevice, errors.New("not registered after 1m0s")}, exitDevice},
+		{fmt.Errorf("step: %w", exitError{exitOtii, errors.New("recording failed")}), exitOtii},
+		{context.Canceled, exitInterrupted},
+		{fmt.Errorf("sleep: %w", context.Canceled), exitInterrupted},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+)
+
+// JUnit XML as rendered by CI servers, with one test case per scenario step
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func seconds(s float64) string {
+	return fmt.Sprintf("%.3f", s)
+}
+
+// writeJUnit writes the results as JUnit test suites, one per run
+func writeJUnit(filename string, results []*runResult) {
+	var suites junitSuites
+	for _, r := range results {
+		suites.Suites = append(suites.Suites, r.junitSuite())
+	}
+	buf, err := xml.MarshalIndent(suites, "", "    ")
+	if err != nil {
+		log.Println("Error encoding JUnit XML:", err)
+		return
+	}
+	if err := ioutil.WriteFile(filename, []byte(xml.Header+string(buf)+"\n"), 0644); err != nil {
+		log.Println("Error writing JUnit XML:", err)
+		return
+	}
+	log.Println("JUnit XML written to", filename)
+}
+
+// junitSuite returns the result as a JUnit test suite named after the device
+// type and scenario. A run failing before the scenario starts is reported as
+// a failed setup test case.
+func (r *runResult) junitSuite() junitSuite {
+	classname := "labdevicetester." + r.DeviceType + "." + r.Scenario
+	name := classname
+	if r.Iteration > 0 {
+		name = fmt.Sprintf("%s #%d", classname, r.Iteration)
+	}
+	suite := junitSuite{
+		Name:      name,
+		Time:      seconds(r.End.Sub(r.Start).Seconds()),
+		Timestamp: r.Start.Format("2006-01-02T15:04:05"),
+	}
+	for _, s := range r.Steps {
+		c := junitCase{Name: s.Name, Classname: classname, Time: seconds(s.Duration)}
+		if s.Status != "passed" {
+			text := s.Error
+			if s.Command != "" {
+				text += "\n--> " + s.Command
+				for _, line := range s.Response {
+					text += "\n<-- " + line
+				}
+			}
+			c.Failure = &junitFailure{Message: s.Error, Type: s.Type, Text: text}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	if len(r.Steps) == 0 && r.Status != "passed" {
+		suite.Cases = append(suite.Cases, junitCase{
+			Name:      "setup",
+			Classname: classname,
+			Time:      suite.Time,
+			Failure:   &junitFailure{Message: r.Error, Type: "setup", Text: r.Error},
+		})
+	}
+	suite.Tests = len(suite.Cases)
+	for _, c := range suite.Cases {
+		if c.Failure != nil {
+			suite.Failures++
+		}
+	}
+
+	return suite
+}
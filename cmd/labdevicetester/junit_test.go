@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "Update the golden files in testdata")
+
+func TestWriteJUnit(t *testing.T) {
+	start := time.Date(2019, 3, 29, 14, 51, 17, 0, time.UTC)
+	results := []*runResult{
+		{
+			Status: "passed", Start: start, End: start.Add(95 * time.Second), Iteration: 1,
+			DeviceType: "n2", Scenario: "send",
+			Steps: []stepResult{
+				{Name: "configure", Type: "configure", Status: "passed", Duration: 12.3456},
+				{Name: "send", Type: "send", Status: "passed", Duration: 15.0004},
+			},
+		},
+		{
+			Status: "failed", Error: "send failed", Start: start.Add(time.Minute), End: start.Add(2 * time.Minute), Iteration: 2,
+			DeviceType: "n2", Scenario: "send",
+			Steps: []stepResult{
+				{Name: "configure", Type: "configure", Status: "passed", Duration: 11},
+				{Name: "send", Type: "send", Status: "failed", Duration: 0.5, Error: "send failed",
+					Command: `AT+NSOST=0,"10.0.0.1",1234,2,"6869"`, Response: []string{`AT+NSOST=0,"10.0.0.1",1234,2,"6869"`, "ERROR"}},
+			},
+		},
+		{
+			Status: "failed", Error: "open /dev/ttyUSB0: no such file or directory", Start: start.Add(3 * time.Minute), End: start.Add(3 * time.Minute),
+			Iteration: 3, DeviceType: "n2", Scenario: "send",
+		},
+	}
+
+	filename := filepath.Join(t.TempDir(), "junit.xml")
+	writeJUnit(filename, results)
+	got, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "junit.xml")
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("JUnit XML =\n%s\nwant\n%s", got, want)
+	}
+}
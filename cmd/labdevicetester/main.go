@@ -1,71 +1,275 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ExploratoryEngineering/labdevicetester/pkg/devicefamily"
 	"github.com/ExploratoryEngineering/labdevicetester/pkg/devicefamily/saran2"
 	"github.com/ExploratoryEngineering/labdevicetester/pkg/devicefamily/sarar4"
 	"github.com/ExploratoryEngineering/labdevicetester/pkg/otii"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/scenario"
 	"github.com/ExploratoryEngineering/labdevicetester/pkg/serial"
 )
 
 func main() {
+	os.Exit(run())
+}
+
+// run runs the test and returns the exit code
+func run() int {
 	var (
 		serialDevice = flag.String("device", "/dev/cu.SLAB_USBtoUART", "Serial device")
 		deviceType   = flag.String("type", "", "Device family type (see pkg/devicefamily subfolders)")
 		verbose      = flag.Bool("v", false, "Verbose output")
 		printIds     = flag.Bool("printids", false, "Print IMSI and IMEI and exit")
-		serverIP     = flag.String("serverip", "10.0.0.1", "IP address to the server receiving data")
+		serverIP     = flag.String("serverip", "10.0.0.1", "IP address or hostname of the server receiving data")
 		apn          = flag.String("apn", "tdt2.telenor.iot", "The APN to connect to")
 		otiiEnabled  = flag.Bool("otii", true, "Skip Otii by setting to false")
+		otiiCLI      = flag.String("otiicli", "", "Path to otiicli (default is $"+otii.CLIEnv+", PATH or the OS install location)")
+		otiiDryRun   = flag.String("otiidryrun", "", "Write Otii scripts to this directory instead of running them")
+		otiiServer   = flag.String("otiiserver", "", "Control the Otii through the TCP server at this address (e.g. 127.0.0.1:1905) instead of otiicli")
+		arc          = flag.String("arc", "", "Id, serial or name of the Otii Arc to use (default is the first Arc found)")
+		listArcs     = flag.Bool("listarcs", false, "List the connected Otii Arcs and exit")
+		apnAuth      = flag.String("apnauth", "none", "APN authentication protocol (none, pap or chap)")
+		apnUser      = flag.String("apnuser", "", "Username for private APNs")
+		apnPassword  = flag.String("apnpassword", "", "Password for private APNs (default $"+apnPasswordEnv+")")
+		threshold    = flag.Float64("threshold", 0.01, "Current threshold in A for the time above threshold metric")
+		plmn         = flag.String("plmn", "", "PLMN for manual operator selection, e.g. 24201 (default is to keep current selection)")
+		rat          = flag.String("rat", "", "Radio access technology to lock to (lte-m or nb-iot)")
+		bands        = flag.String("bands", "", "Comma separated list of bands to lock to, e.g. 20,8")
+		scanOps      = flag.Bool("scanoperators", false, "Scan for operators, print them and exit")
+		coldBoot     = flag.Bool("coldboot", false, "Power cycle the device with the Otii and measure the boot before testing")
+		bootDuration = flag.Duration("bootduration", 20*time.Second, "Length of the boot recording")
+		battery      = flag.String("battery", "", "Emulate a discharging battery while recording, from:to:duration[:steps] (e.g. 3.6:3.0:30s:10) or a CSV file of seconds,volts")
+		planFile     = flag.String("plan", "", "Test plan JSON file with the measurement configuration")
+		scenarioName = flag.String("scenario", "send", "Test flow, a scenario JSON file or one of "+strings.Join(scenario.Names(), ", "))
+		powerOff     = flag.Bool("interruptpoweroff", false, "Turn off main power on the Otii when interrupted")
+		junitFile    = flag.String("junit", "", "Write the result as JUnit XML to this file")
+		repeat       = flag.Int("repeat", 1, "Run the scenario this many times and summarize the runs")
+		soak         = flag.Duration("soak", 0, "Repeat the scenario until this much time has passed, e.g. 8h (overrides -repeat)")
+		sweepFile    = flag.String("sweep", "", "Run the scenario with every combination of the parameters in this sweep JSON file")
+		reclean      = flag.Bool("reclean", false, "Reboot and clean the module in every repeated run, not just the first")
+		benchFile    = flag.String("bench", "", "Test the devices in this bench JSON file at the same time, with the other flags applied to every device")
+		syncGPIO     = flag.Int("syncgpio", -1, "Module GPIO wired to the Otii digital input 1 for sync pulses at phase boundaries (e.g. 16 for GPIO1 on the R4)")
+		measureFlags = addMeasurementFlags()
 	)
 	flag.Parse()
 
-	startTime := time.Now().Format("2006-01-02 15:04:05")
-	logFile, err := os.OpenFile("captures/labdevicetester-"+*deviceType+"-"+startTime+".log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if *benchFile != "" {
+		return runBench(*benchFile)
+	}
+
+	plan, err := loadPlan(*planFile)
+	if err != nil {
+		log.Print("Error reading test plan: ", err)
+		return exitConfig
+	}
+	measureFlags.apply(&plan.Measurement)
+	if *syncGPIO >= 0 && !contains(plan.Measurement.Channels, syncChannel) {
+		plan.Measurement.Channels = append(plan.Measurement.Channels, syncChannel)
+	}
+	if *battery != "" {
+		profile, err := otii.ParseBatteryProfile(*battery)
+		if err != nil {
+			log.Print("Invalid battery profile: ", err)
+			return exitConfig
+		}
+		plan.Measurement.Battery = &profile
+	}
+	if err := plan.Measurement.Validate(); err != nil {
+		log.Print("Invalid measurement configuration: ", err)
+		return exitConfig
+	}
+
+	flow, err := scenario.Find(*scenarioName)
 	if err != nil {
-		log.Fatal("Unable to open log file:", err)
+		log.Print("Error reading scenario: ", err)
+		return exitConfig
+	}
+
+	if *repeat < 1 || *soak < 0 {
+		log.Print("Invalid -repeat or -soak")
+		return exitConfig
+	}
+	repeating := *repeat > 1 || *soak > 0
+
+	variants := []scenario.Variant{{Scenario: flow}}
+	if *sweepFile != "" {
+		if *soak > 0 {
+			log.Print("-soak can't be combined with -sweep")
+			return exitConfig
+		}
+		sweep, err := scenario.LoadSweep(*sweepFile)
+		if err != nil {
+			log.Print("Error reading sweep: ", err)
+			return exitConfig
+		}
+		variants = sweep.Variants(flow)
+	}
+
+	password := *apnPassword
+	if password == "" {
+		password = os.Getenv(apnPasswordEnv)
+	}
+	auth, err := parseAuth(*apnAuth, *apnUser, password)
+	if err != nil {
+		log.Print("Invalid APN authentication: ", err)
+		return exitConfig
+	}
+
+	network, err := parseNetworkSelection(*plmn, *rat, *bands)
+	if err != nil {
+		log.Print("Invalid network selection: ", err)
+		return exitConfig
+	}
+
+	start := time.Now()
+	logBase := "captures/labdevicetester-" + *deviceType + "-" + flow.Name + "-" + start.Format("20060102T150405")
+	logFile, err := os.OpenFile(logBase+".log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Print("Unable to open log file:", err)
+		return exitConfig
 	}
 	mw := io.MultiWriter(os.Stdout, logFile)
 	log.SetOutput(mw)
-	log.SetFlags(log.Ltime)
+	log.SetFlags(log.Ltime | log.Lmicroseconds)
+
+	// The first interrupt stops the scenario and saves what has been
+	// recorded, the second exits right away
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupts := make(chan os.Signal, 2)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		<-interrupts
+		log.Println("Interrupted, stopping...")
+		cancel()
+		<-interrupts
+		log.Println("Interrupted again, exiting")
+		os.Exit(exitInterrupted)
+	}()
+
+	otii.Init(*otiiEnabled)
+	if err := otii.SetDryRun(*otiiDryRun); err != nil {
+		log.Print("Error creating Otii dry-run directory:", err)
+		return exitConfig
+	}
+	if *otiiEnabled && *otiiServer == "" && *otiiDryRun == "" {
+		if err := otii.SetCLI(*otiiCLI); err != nil {
+			log.Print("Error locating otiicli:", err)
+			return exitOtii
+		}
+	}
+	if *otiiServer != "" {
+		if err := otii.Connect(*otiiServer); err != nil {
+			log.Print("Error connecting to Otii server:", err)
+			return exitOtii
+		}
+	}
+	otii.SelectDevice(*arc)
+	if *listArcs {
+		arcs, err := otii.Devices()
+		if err != nil {
+			log.Print("Error listing Otii Arcs:", err)
+			return exitOtii
+		}
+		for _, a := range arcs {
+			fmt.Printf("%s\t%s\n", a.ID, a.Name)
+		}
+		return exitOK
+	}
 
 	var device devicefamily.Interface
 	switch *deviceType {
 	default:
-		log.Fatal("Invalid device type")
+		log.Print("Invalid device type")
+		return exitConfig
 	case "n2":
 		device = saran2.New()
 	case "r4":
 		device = sarar4.New()
 	}
 
-	otii.Init(*otiiEnabled)
-	// if err := otii.EnableMainPower(); err != nil {
-	// 	log.Fatal("Error enabling main power:", err)
-	// }
-	// defer otii.DisableMainPower()
+	for _, protocol := range flow.Protocols() {
+		if !device.SupportsProtocol(strings.ToUpper(protocol)) {
+			log.Printf("Scenario %s sends %s, which the %s doesn't support", flow.Name, strings.ToUpper(protocol), *deviceType)
+			return exitConfig
+		}
+	}
+	if plan.Measurement.Battery != nil && !device.DetectsResets() {
+		log.Printf("Warning: the %s has no boot URC, brown-out resets during the battery emulation won't be detected", *deviceType)
+	}
+	if *coldBoot && !*otiiEnabled {
+		log.Print("Cold boot requires the Otii")
+		return exitConfig
+	}
 	if err := otii.Calibrate(); err != nil {
-		log.Fatal("Error calibrating:", err)
+		log.Print("Error calibrating:", err)
+		return exitOtii
 	}
 
 	s, err := serial.NewSerialConnection(*serialDevice, device.BaudRate(), *verbose)
 	if err != nil {
 		log.Println("Unable to open serial port:", err)
-		return
+		return exitDevice
 	}
 	defer s.Close()
 
+	// Every AT command and URC is timestamped so that they can be lined up
+	// with the capture
+	timeline := serial.NewTimeline()
+	s.SetTimeline(timeline)
+
 	device.Init(s)
 
+	result := runResult{
+		Start:      start,
+		DeviceType: *deviceType,
+		Scenario:   flow.Name,
+		Parameters: runParameters{
+			APN:         *apn,
+			Server:      *serverIP,
+			Port:        1234,
+			PLMN:        *plmn,
+			RAT:         *rat,
+			Bands:       network.bands,
+			Flow:        flow,
+			Measurement: plan.Measurement,
+		},
+	}
+	// finish writes the result, reports the outcome of the run and returns
+	// the exit code
+	finish := func(err error) int {
+		result.finish(err, logBase)
+		if *junitFile != "" {
+			writeJUnit(*junitFile, []*runResult{&result})
+		}
+		if err != nil {
+			reportError()
+			return exitCode(err)
+		}
+		log.Println("Success!")
+		return exitOK
+	}
+
+	if *coldBoot {
+		if err := result.coldBoot(device, plan.Measurement, *bootDuration, *otiiDryRun == ""); err != nil {
+			return finish(err)
+		}
+	}
+
 	if !checkSerial(s) {
-		reportError()
-		return
+		return finish(exitError{exitDevice, errors.New("device not responding")})
 	}
 
 	if *printIds {
@@ -80,53 +284,122 @@ func main() {
 
 		log.Println("IMSI:", imsi)
 		log.Println("IMEI:", imei)
-		return
+		return exitOK
+	}
+
+	if *scanOps {
+		operators, err := device.ScanOperators()
+		if err != nil {
+			log.Println("Error: ", err)
+			return exitFailed
+		}
+		for _, op := range operators {
+			log.Printf("Operator: %s (%s) PLMN %s AcT %d status %d", op.LongName, op.ShortName, op.PLMN, op.AccessTechnology, op.Status)
+		}
+		return exitOK
 	}
 
-	device.FirmwareVersion()
+	result.identify(device)
 
-	if !clean(device, *apn) {
-		log.Println("Clean failed")
-		reportError()
-		return
+	syncs := newSyncer(device, *syncGPIO)
+	if !syncs.configure() {
+		return finish(errors.New("configuring the sync GPIO failed"))
 	}
 
-	time.Sleep(time.Second * 5)
+	// Repeated runs are the same scenario on a module that's already set up,
+	// so only the first run of each variant reboots unless -reclean is set
+	var results []*runResult
+	var summaries []comparisonRow
+	var failed error
+	n := 0
+	for _, v := range variants {
+		if v.Parameters != "" {
+			log.Printf("Variant %s: %s", v.Scenario.Name, v.Parameters)
+		}
+		var runs []*runResult
+		for i := 1; ctx.Err() == nil; i++ {
+			n++
+			r := result
+			r.Start = time.Now()
+			r.Scenario = v.Scenario.Name
+			r.Parameters.Flow = v.Scenario
+			r.Parameters.Sweep = v.Parameters
+			steps := v.Scenario
+			if repeating || len(variants) > 1 {
+				r.Iteration = n
+			}
+			if repeating {
+				log.Printf("Run %d", i)
+				if i > 1 && !*reclean {
+					steps = v.Scenario.WithoutReboot()
+				}
+			}
+			t := &tester{
+				device:    device,
+				timeline:  timeline,
+				syncs:     syncs,
+				plan:      plan,
+				result:    &r,
+				apn:       *apn,
+				auth:      auth,
+				network:   network,
+				server:    *serverIP,
+				port:      r.Parameters.Port,
+				threshold: *threshold,
+				analyze:   *otiiEnabled && *otiiDryRun == "",
+			}
+			runner := scenario.Runner{Actions: t}
+			err = runner.Run(ctx, steps)
+			// A step failing because the module stopped responding is a
+			// device failure rather than a test failure
+			if err != nil && exitCode(err) == exitFailed && s.TimedOut() {
+				err = exitError{exitDevice, err}
+			}
+			r.addSteps(runner.Results, timeline)
+			r.finish(err, logBase)
+			runs = append(runs, &r)
+			if err != nil && failed == nil {
+				failed = err
+			}
 
-	failCount := 0
-	for {
-		status, err := device.RegistrationStatus()
-		if err != nil {
-			log.Println("Status failed")
-			failCount++
-			if failCount > 5 {
-				reportError()
-				return
+			if *soak > 0 {
+				if time.Since(start) >= *soak {
+					break
+				}
+			} else if i >= *repeat {
+				break
 			}
 		}
-		if status == 1 {
-			break
+		results = append(results, runs...)
+		if len(runs) > 0 {
+			summaries = append(summaries, comparisonRow{Name: v.Scenario.Name, Parameters: v.Parameters, Summary: summarizeRuns(runs)})
 		}
-		log.Println("Not connected... status:", status)
-		time.Sleep(time.Second)
 	}
-
-	time.Sleep(30 * time.Second)
-
-	recording := record(30 * time.Second)
-	time.Sleep(5 * time.Second)
-	for i := 0; i < 3; i++ {
-		if !sendSmallPacket(device, *serverIP) {
-			reportError()
-			return
+	if ctx.Err() != nil && *powerOff {
+		log.Println("Turning off main power")
+		if err := otii.DisableMainPower(); err != nil {
+			log.Println("Error disabling main power:", err)
 		}
-		time.Sleep(5 * time.Second)
 	}
-	<-recording
-
-	// TODO print status
 
+	if *junitFile != "" {
+		writeJUnit(*junitFile, results)
+	}
+	if len(variants) > 1 {
+		writeComparison(logBase+"-sweep.csv", summaries)
+	} else if repeating {
+		summarizeRuns(results).write(logBase + "-summary.json")
+	}
+	// The exit code is that of the first failed run, unless interrupted
+	if ctx.Err() != nil {
+		failed = ctx.Err()
+	}
+	if failed != nil {
+		reportError()
+		return exitCode(failed)
+	}
 	log.Println("Success!")
+	return exitOK
 }
 
 func checkSerial(s *serial.SerialConnection) bool {
@@ -151,59 +424,110 @@ func reportError() {
 	log.Println("=======================================")
 }
 
-func clean(d devicefamily.Interface, apn string) bool {
+func clean(d devicefamily.Interface, apn string, auth devicefamily.PDPAuth, network networkSelection) bool {
 	return d.RebootModule() &&
+		network.lockRadio(d) &&
 		d.SetRadio(devicefamily.RadioFull) &&
+		enableNITZ(d) &&
+		setAuth(d, apn, auth) &&
 		d.SetAPN(apn) &&
 		//d.AutoOperatorSelection() &&
-		d.PowerSaveMode(1, 223, 1) &&
-		d.DisableEDRX()
+		network.selectOperator(d)
 }
 
-func record(duration time.Duration) chan struct{} {
-	// TODO create captures folder
-	ch := make(chan struct{})
-	go func() {
-		otii.Record(duration)
-		ch <- struct{}{}
-	}()
-	return ch
+// enableNITZ enables the NITZ URCs before SetAPN attaches, since the network
+// sends the time during the attach. The test doesn't need the time, so a
+// failure is only logged.
+func enableNITZ(d devicefamily.Interface) bool {
+	if !d.EnableNITZ() {
+		log.Println("NITZ reporting not enabled, the NITZ offset won't be reported")
+	}
+	return true
 }
 
-func sendSmallPacket(d devicefamily.Interface, serverIP string) bool {
-	socket, err := d.CreateSocket("UDP", 1234)
-	if err != nil {
-		log.Println("Error: ", err)
-		reportError()
-		return false
+// setAuth defines the default context and sets its authentication before
+// SetAPN attaches, since an attach without it is rejected on private APNs
+func setAuth(d devicefamily.Interface, apn string, auth devicefamily.PDPAuth) bool {
+	if auth.Protocol == devicefamily.AuthNone {
+		return true
 	}
-	defer d.CloseSocket(socket)
-	d.SendUDP(socket, serverIP, 1234, devicefamily.SendFlagReleaseAfterNextMessage, []byte("hi"))
-	return true
+	ctx := devicefamily.PDPContext{CID: d.DefaultContextID(), Type: "IP", APN: apn}
+	return d.DefinePDPContext(ctx) && d.SetPDPAuth(ctx.CID, auth)
 }
 
-func sendAndReceive(d devicefamily.Interface, serverIP string) bool {
-	socket, err := d.CreateSocket("UDP", 1234)
-	if err != nil {
-		log.Println("Error: ", err)
-		reportError()
-		return false
+func parseAuth(protocol, username, password string) (devicefamily.PDPAuth, error) {
+	auth := devicefamily.PDPAuth{Username: username, Password: password}
+	switch protocol {
+	case "none":
+		auth.Protocol = devicefamily.AuthNone
+	case "pap":
+		auth.Protocol = devicefamily.AuthPAP
+	case "chap":
+		auth.Protocol = devicefamily.AuthCHAP
+	default:
+		return auth, fmt.Errorf("unknown protocol %q", protocol)
 	}
-	defer d.CloseSocket(socket)
+	return auth, nil
+}
 
-	time.Sleep(1 * time.Second)
+// networkSelection pins the device to an operator, RAT and set of bands so
+// that runs against the network simulator and live networks use the same cell
+// configuration. Zero values leave the device configuration untouched.
+type networkSelection struct {
+	plmn  string
+	rat   *devicefamily.RAT
+	bands []int
+}
 
-	if !d.SendUDP(socket, serverIP, 1234, devicefamily.SendFlagReleaseAfterNextReply, []byte("echo hi")) {
-		reportError()
-		return false
+func parseNetworkSelection(plmn, rat, bands string) (networkSelection, error) {
+	n := networkSelection{plmn: plmn}
+	if rat != "" {
+		r, err := devicefamily.ParseRAT(rat)
+		if err != nil {
+			return n, err
+		}
+		n.rat = &r
+	}
+	if bands != "" {
+		if n.rat == nil {
+			return n, errors.New("bands require a RAT")
+		}
+		for _, b := range strings.Split(bands, ",") {
+			band, err := strconv.Atoi(strings.TrimSpace(b))
+			if err != nil {
+				return n, fmt.Errorf("invalid band %q", b)
+			}
+			n.bands = append(n.bands, band)
+		}
 	}
+	return n, nil
+}
 
-	_, err = d.ReceiveUDP(socket, 7)
-	if err != nil {
-		log.Printf("Error receiving: %v", err)
-		reportError()
+func (n networkSelection) lockRadio(d devicefamily.Interface) bool {
+	if n.rat == nil {
+		return true
+	}
+	if !d.SetRAT(*n.rat) {
 		return false
 	}
-
+	if len(n.bands) > 0 {
+		return d.SetBands(*n.rat, n.bands)
+	}
 	return true
 }
+
+func (n networkSelection) selectOperator(d devicefamily.Interface) bool {
+	if n.plmn == "" {
+		return true
+	}
+	return d.ManualOperatorSelection(n.plmn)
+}
+
+func record(m otii.Measurement, duration time.Duration, filename string) chan error {
+	// TODO create captures folder
+	ch := make(chan error, 1)
+	go func() {
+		ch <- otii.Record(m, duration, filename)
+	}()
+	return ch
+}
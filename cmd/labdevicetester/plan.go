@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/otii"
+)
+
+// testPlan is the test configuration read from the -plan file. Flags set on
+// the command line override the plan.
+type testPlan struct {
+	Measurement otii.Measurement `json:"measurement"`
+}
+
+func loadPlan(filename string) (testPlan, error) {
+	plan := testPlan{Measurement: otii.DefaultMeasurement}
+	if filename == "" {
+		return plan, nil
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return plan, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&plan); err != nil {
+		return plan, err
+	}
+	return plan, nil
+}
+
+// measurementFlags are the command line overrides of the measurement
+// configuration
+type measurementFlags struct {
+	voltage     *float64
+	currentRng  *string
+	maxCurrent  *float64
+	channels    *string
+	adcResistor *float64
+	sampleRate  *int
+	captureName *string
+}
+
+func addMeasurementFlags() *measurementFlags {
+	d := otii.DefaultMeasurement
+	return &measurementFlags{
+		voltage:     flag.Float64("voltage", d.MainVoltage, "Otii main voltage in V"),
+		currentRng:  flag.String("range", d.Range, "Otii main current range (low or high)"),
+		maxCurrent:  flag.Float64("maxcurrent", d.MaxCurrent, "Otii overcurrent limit in A"),
+		channels:    flag.String("channels", strings.Join(d.Channels, ","), "Comma separated Otii channels to record (mc, mv, ac, av, i1, i2, ...)"),
+		adcResistor: flag.Float64("adcresistor", d.ADCResistor, "Otii ADC shunt resistor in ohms (0 to leave unchanged)"),
+		sampleRate:  flag.Int("samplerate", d.SampleRate, "Otii sample rate in samples per second (0 for default)"),
+		captureName: flag.String("capturename", d.Filename, "Capture filename template, {type}, {scenario} and {time} are expanded"),
+	}
+}
+
+// apply sets the flags given on the command line in m
+func (f *measurementFlags) apply(m *otii.Measurement) {
+	flag.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "voltage":
+			m.MainVoltage = *f.voltage
+		case "range":
+			m.Range = *f.currentRng
+		case "maxcurrent":
+			m.MaxCurrent = *f.maxCurrent
+		case "channels":
+			m.Channels = strings.Split(*f.channels, ",")
+		case "adcresistor":
+			m.ADCResistor = *f.adcResistor
+		case "samplerate":
+			m.SampleRate = *f.sampleRate
+		case "capturename":
+			m.Filename = *f.captureName
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/stats"
+)
+
+// repeatSummary is the statistical summary of the runs with -repeat or -soak.
+// Only the runs that passed are included in the statistics.
+type repeatSummary struct {
+	DeviceType string `json:"device_type"`
+	Scenario   string `json:"scenario"`
+	Runs       int    `json:"runs"`
+	Passed     int    `json:"passed"`
+	// RecordingEnergyPerPacket is the energy of the recordings of a run
+	// divided by the packets sent while recording
+	RecordingEnergyPerPacket stats.Summary `json:"recording_energy_per_packet_j"`
+	RegistrationTime         stats.Summary `json:"registration_time_s"`
+	RoundTripTime            stats.Summary `json:"round_trip_time_s"`
+	// Results are the result files of the runs
+	Results []string `json:"results"`
+}
+
+func summarizeRuns(results []*runResult) repeatSummary {
+	s := repeatSummary{Runs: len(results)}
+	var energy, registration, rtt []float64
+	for _, r := range results {
+		s.DeviceType, s.Scenario = r.DeviceType, r.Scenario
+		s.Results = append(s.Results, r.filename)
+		if r.Status != "passed" {
+			continue
+		}
+		s.Passed++
+		if e, ok := r.recordingEnergyPerPacket(); ok {
+			energy = append(energy, e)
+		}
+		if r.RegistrationTime > 0 {
+			registration = append(registration, r.RegistrationTime)
+		}
+		for _, d := range r.RoundTrips {
+			rtt = append(rtt, d)
+		}
+	}
+	s.RecordingEnergyPerPacket = stats.Summarize(energy)
+	s.RegistrationTime = stats.Summarize(registration)
+	s.RoundTripTime = stats.Summarize(rtt)
+	return s
+}
+
+// write logs the summary and writes it as JSON to filename
+func (s repeatSummary) write(filename string) {
+	log.Printf("%d of %d runs passed", s.Passed, s.Runs)
+	log.Println("Recording energy per packet:", s.RecordingEnergyPerPacket.Format("%.4f J"))
+	log.Println("Registration time:", s.RegistrationTime.Format("%.2f s"))
+	log.Println("Round trip time:", s.RoundTripTime.Format("%.3f s"))
+
+	buf, err := json.MarshalIndent(s, "", "    ")
+	if err != nil {
+		log.Println("Error encoding summary:", err)
+		return
+	}
+	if err := ioutil.WriteFile(filename, buf, 0644); err != nil {
+		log.Println("Error writing summary:", err)
+		return
+	}
+	log.Println("Summary written to", filename)
+}
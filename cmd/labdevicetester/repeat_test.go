@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/otii/capture"
+)
+
+func TestRecordingEnergyPerPacket(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordings []*recordingResult
+		want       float64
+		ok         bool
+	}{
+		{"none", nil, 0, false},
+		{"no packets", []*recordingResult{{Metrics: &capture.Metrics{Energy: 1}}}, 0, false},
+		{"not analyzed", []*recordingResult{{PacketsSent: 3}}, 0, false},
+		{"one", []*recordingResult{{PacketsSent: 4, Metrics: &capture.Metrics{Energy: 1}}}, 0.25, true},
+		{"two", []*recordingResult{
+			{PacketsSent: 1, Metrics: &capture.Metrics{Energy: 0.5}},
+			{PacketsSent: 3, Metrics: &capture.Metrics{Energy: 1.5}},
+		}, 0.5, true},
+	}
+	for _, tt := range tests {
+		// Packets sent outside the recordings don't count
+		r := &runResult{PacketsSent: 10, Recordings: tt.recordings}
+		got, ok := r.recordingEnergyPerPacket()
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: recordingEnergyPerPacket() = %g, %v, want %g, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSummarizeRuns(t *testing.T) {
+	results := []*runResult{
+		{Status: "passed", PacketsSent: 5, RegistrationTime: 2, RoundTrips: []float64{1},
+			Recordings: []*recordingResult{{PacketsSent: 3, Metrics: &capture.Metrics{Energy: 0.3}}}},
+		{Status: "failed", PacketsSent: 1, RegistrationTime: 9},
+		{Status: "passed", PacketsSent: 3, RegistrationTime: 4,
+			Recordings: []*recordingResult{{PacketsSent: 3, Metrics: &capture.Metrics{Energy: 0.9}}}},
+	}
+	s := summarizeRuns(results)
+	if s.Runs != 3 || s.Passed != 2 || len(s.Results) != 3 {
+		t.Errorf("%d of %d runs passed, %d results", s.Passed, s.Runs, len(s.Results))
+	}
+	if e := s.RecordingEnergyPerPacket; e.N != 2 || !near(e.Mean, 0.2) {
+		t.Errorf("recording energy per packet %+v, want mean 0.2", e)
+	}
+	if r := s.RegistrationTime; r.N != 2 || r.Mean != 3 {
+		t.Errorf("registration time %+v, want mean 3", r)
+	}
+	if rtt := s.RoundTripTime; rtt.N != 1 || rtt.Mean != 1 {
+		t.Errorf("round trip time %+v, want mean 1", rtt)
+	}
+}
+
+func near(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/devicefamily"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/otii"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/scenario"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/serial"
+)
+
+// deviceInfo identifies the device under test
+type deviceInfo struct {
+	Firmware string `json:"firmware,omitempty"`
+	IMEI     string `json:"imei,omitempty"`
+	IMSI     string `json:"imsi,omitempty"`
+}
+
+// runParameters are the settings of a run
+type runParameters struct {
+	APN         string            `json:"apn"`
+	Server      string            `json:"server"`
+	Port        int               `json:"port"`
+	PLMN        string            `json:"plmn,omitempty"`
+	RAT         string            `json:"rat,omitempty"`
+	Bands       []int             `json:"bands,omitempty"`
+	Flow        scenario.Scenario `json:"flow"`
+	Measurement otii.Measurement  `json:"measurement"`
+	// Sweep describes the sweep parameters of the flow
+	Sweep string `json:"sweep,omitempty"`
+}
+
+// stepResult is the outcome of a scenario step
+type stepResult struct {
+	Name   string    `json:"name"`
+	Type   string    `json:"type"`
+	Status string    `json:"status"`
+	Start  time.Time `json:"start"`
+	// Duration is in seconds
+	Duration float64 `json:"duration_s"`
+	Error    string  `json:"error,omitempty"`
+	// Command and Response are the last AT command of a failed step and
+	// the lines received after it
+	Command  string   `json:"command,omitempty"`
+	Response []string `json:"response,omitempty"`
+}
+
+// identify reads the firmware version, IMEI and IMSI of the device
+func (r *runResult) identify(d devicefamily.Interface) {
+	r.Device.Firmware, _ = d.FirmwareVersion()
+	if imei, err := d.IMEI(); err == nil {
+		r.Device.IMEI = strconv.Itoa(imei)
+	}
+	if imsi, err := d.IMSI(); err == nil {
+		r.Device.IMSI = strconv.Itoa(imsi)
+	}
+}
+
+// addSteps adds the results of the scenario steps. The AT command that failed
+// in a failed step is looked up in the timeline.
+func (r *runResult) addSteps(results []scenario.StepResult, timeline *serial.Timeline) {
+	for _, res := range results {
+		s := stepResult{
+			Name:     res.Step.Title(),
+			Type:     res.Step.Type,
+			Status:   "passed",
+			Start:    res.Start,
+			Duration: res.Duration.Seconds(),
+		}
+		if errors.Is(res.Err, context.Canceled) {
+			s.Status = "interrupted"
+			s.Error = "interrupted"
+		} else if res.Err != nil {
+			s.Status = "failed"
+			s.Error = res.Err.Error()
+			s.Command, s.Response = lastCommand(timeline.Since(res.Start), res.Start.Add(res.Duration))
+		}
+		r.Steps = append(r.Steps, s)
+	}
+}
+
+// lastCommand returns the command that failed before end and the lines
+// received after it. That's the last command without an OK response, since
+// cleanup like closing a socket may follow the command that failed, or the
+// last command if they all succeeded.
+func lastCommand(events []serial.Event, end time.Time) (string, []string) {
+	type exchange struct {
+		command  string
+		response []string
+	}
+	var exchanges []exchange
+	for _, e := range events {
+		if e.Time.After(end) {
+			break
+		}
+		switch e.Direction {
+		case serial.Command:
+			exchanges = append(exchanges, exchange{command: e.Line})
+		default:
+			if e.Line != "" && len(exchanges) > 0 {
+				last := &exchanges[len(exchanges)-1]
+				last.response = append(last.response, e.Line)
+			}
+		}
+	}
+	if len(exchanges) == 0 {
+		return "", nil
+	}
+	for i := len(exchanges) - 1; i >= 0; i-- {
+		if !contains(exchanges[i].response, "OK") {
+			return exchanges[i].command, exchanges[i].response
+		}
+	}
+	last := exchanges[len(exchanges)-1]
+	return last.command, last.response
+}
+
+// finish sets the outcome of the run, nil if it passed, and writes the
+// result next to the first capture, or to logBase.json if nothing was
+// recorded.
+// Repeated runs without a capture are written to logBase-<iteration>.json.
+func (r *runResult) finish(err error, logBase string) {
+	r.End = time.Now()
+	r.Status = "passed"
+	switch {
+	case errors.Is(err, context.Canceled):
+		r.Status = "interrupted"
+		r.Error = "interrupted"
+	case err != nil:
+		r.Status = "failed"
+		r.Error = err.Error()
+	}
+
+	r.filename = logBase + ".json"
+	if r.Iteration > 0 {
+		r.filename = fmt.Sprintf("%s-%d.json", logBase, r.Iteration)
+	}
+	if len(r.Recordings) > 0 {
+		r.filename = strings.TrimSuffix(r.Recordings[0].Capture, ".otii") + ".json"
+	}
+	buf, err := json.MarshalIndent(r, "", "    ")
+	if err != nil {
+		log.Println("Error encoding result:", err)
+		return
+	}
+	if err := ioutil.WriteFile(r.filename, buf, 0644); err != nil {
+		log.Println("Error writing result:", err)
+		return
+	}
+	log.Println("Result written to", r.filename)
+}
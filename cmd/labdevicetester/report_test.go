@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/devicefamily/sarar4"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/scenario"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/serial"
+)
+
+// fakeModule echoes the commands written to it and replies with the
+// response of the first matching prefix, or OK
+type fakeModule struct {
+	responses map[string]string
+	pending   bytes.Buffer
+}
+
+func (m *fakeModule) Read(b []byte) (int, error) {
+	if m.pending.Len() == 0 {
+		return 0, io.EOF
+	}
+	return m.pending.Read(b)
+}
+
+func (m *fakeModule) Write(b []byte) (int, error) {
+	cmd := strings.TrimSuffix(string(b), "\r\n")
+	response := "OK"
+	for prefix, r := range m.responses {
+		if strings.HasPrefix(cmd, prefix) {
+			response = r
+		}
+	}
+	m.pending.WriteString(cmd + "\r\r\n" + response + "\r\n")
+	return len(b), nil
+}
+
+func (m *fakeModule) Close() error {
+	return nil
+}
+
+func TestFailedCommand(t *testing.T) {
+	s := serial.NewPortConnection(&fakeModule{responses: map[string]string{
+		"AT+USOCR": "+USOCR: 0\r\n\r\nOK",
+		"AT+USOST": "ERROR",
+	}}, false)
+	timeline := serial.NewTimeline()
+	s.SetTimeline(timeline)
+	device := sarar4.New()
+	device.Init(s)
+	r := &runResult{DeviceType: "r4", Scenario: "send"}
+	tester := &tester{device: device, timeline: timeline, result: r, server: "10.0.0.1", port: 1234, socket: -1}
+
+	runner := scenario.Runner{Actions: tester}
+	if err := runner.Run(context.Background(), scenario.Scenario{Name: "send", Steps: []scenario.Step{{Type: scenario.Send}}}); err == nil {
+		t.Fatal("send succeeded")
+	}
+	r.addSteps(runner.Results, timeline)
+
+	// The socket is closed after the send failed, but the failure is the send
+	step := r.Steps[0]
+	if want := `AT+USOST=0,"10.0.0.1",1234,2,"hi"`; step.Status != "failed" || step.Command != want {
+		t.Errorf("step %s with command %q, want failed with %q", step.Status, step.Command, want)
+	}
+	if len(step.Response) == 0 || step.Response[len(step.Response)-1] != "ERROR" {
+		t.Errorf("response %q, want ERROR", step.Response)
+	}
+	failure := r.junitSuite().Cases[0].Failure
+	if failure == nil || !strings.Contains(failure.Text, "--> AT+USOST=") || strings.Contains(failure.Text, "AT+USOCL") {
+		t.Errorf("JUnit failure %+v", failure)
+	}
+}
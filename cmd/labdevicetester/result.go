@@ -0,0 +1,239 @@
+package main
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/devicefamily"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/otii/capture"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/serial"
+)
+
+// runResult is the outcome of a test run. It's written as JSON next to the
+// capture when the run completes.
+type runResult struct {
+	// Status is "passed", "failed" or "interrupted"
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	// Iteration is the number of the run with -repeat or -soak, from 1
+	Iteration  int           `json:"iteration,omitempty"`
+	DeviceType string        `json:"device_type"`
+	Device     deviceInfo    `json:"device"`
+	Scenario   string        `json:"scenario"`
+	Parameters runParameters `json:"parameters"`
+	Steps      []stepResult  `json:"steps"`
+	Boot       *bootResult   `json:"boot,omitempty"`
+	// RegistrationTime is the seconds from the attach after the module was
+	// rebooted until it's registered. It's zero if the module wasn't rebooted.
+	RegistrationTime float64 `json:"registration_time_s"`
+	PacketsSent      int     `json:"packets_sent"`
+	PacketsEchoed    int     `json:"packets_echoed"`
+	// RoundTrips are the seconds from a packet is sent until the echo is
+	// received
+	RoundTrips []float64 `json:"round_trips_s,omitempty"`
+	// Recordings are the results of the record steps, in the order they ran
+	Recordings []*recordingResult `json:"recordings,omitempty"`
+	// Resets are the unexpected module resets during the test
+	Resets []devicefamily.Reset `json:"resets,omitempty"`
+
+	// filename is where the result is written
+	filename string
+}
+
+// recordingResult is the outcome of a record step
+type recordingResult struct {
+	Capture string `json:"capture"`
+	// Start is the host time the recording was started
+	Start time.Time `json:"start"`
+	// PacketsSent are the packets sent during the recording
+	PacketsSent int                    `json:"packets_sent"`
+	Metrics     *capture.Metrics       `json:"metrics,omitempty"`
+	Phases      []capture.Phase        `json:"phases,omitempty"`
+	PhaseTotal  []capture.PhaseSummary `json:"phase_total,omitempty"`
+	Markers     []marker               `json:"markers,omitempty"`
+	Commands    []commandEnergy        `json:"commands,omitempty"`
+	// MinVoltage is the lowest main voltage in the capture
+	MinVoltage float64 `json:"min_voltage_v,omitempty"`
+	// SyncPulses are the sync pulses found in the capture
+	SyncPulses []syncPulse `json:"sync_pulses,omitempty"`
+	// ClockOffset is the seconds added to host times to get capture times.
+	// It's zero unless sync pulses were found.
+	ClockOffset float64 `json:"clock_offset_s"`
+}
+
+// lastRecording returns the result of the last record step, nil if nothing
+// has been recorded
+func (r *runResult) lastRecording() *recordingResult {
+	if len(r.Recordings) == 0 {
+		return nil
+	}
+	return r.Recordings[len(r.Recordings)-1]
+}
+
+// recordingEnergyPerPacket returns the energy of the analyzed recordings
+// divided by the packets sent while they were recorded. Packets sent outside
+// the recordings aren't counted since their energy isn't measured.
+func (r *runResult) recordingEnergyPerPacket() (float64, bool) {
+	energy, packets := 0.0, 0
+	for _, rec := range r.Recordings {
+		if rec.Metrics == nil {
+			continue
+		}
+		energy += rec.Metrics.Energy
+		packets += rec.PacketsSent
+	}
+	if packets == 0 {
+		return 0, false
+	}
+	return energy / float64(packets), true
+}
+
+// checkResets looks for module resets after the first known resets, which
+// are expected reboots, and stores them in the result. It returns false if
+// the module has reset, e.g. because of a brown-out.
+func (r *runResult) checkResets(d devicefamily.Interface, known int) bool {
+	resets := d.Resets()
+	if len(resets) <= known {
+		return true
+	}
+	r.Resets = resets[known:]
+	for _, reset := range r.Resets {
+		log.Printf("Brown-out: module reset at %s (%s)", reset.Time.Format("15:04:05.000000"), reset.Line)
+	}
+	return false
+}
+
+// marker is an AT command, response or URC relative to the recording. The
+// offsets are in seconds.
+type marker struct {
+	// Offset is from the recording Start, measured with the monotonic clock
+	Offset float64 `json:"offset_s"`
+	// CaptureOffset is from the start of the recording in the capture
+	CaptureOffset float64 `json:"capture_offset_s"`
+	Direction     string  `json:"direction"`
+	Line          string  `json:"line"`
+}
+
+// commandEnergy is the energy consumed from an AT command is sent until the
+// next one. The offset from the start of the capture and the duration are in
+// seconds.
+type commandEnergy struct {
+	Command  string  `json:"command"`
+	Offset   float64 `json:"offset_s"`
+	Duration float64 `json:"duration_s"`
+	Energy   float64 `json:"energy_j"`
+	Charge   float64 `json:"charge_mah"`
+}
+
+// addMarkers adds the serial events from the recording start to the result
+func (r *recordingResult) addMarkers(events []serial.Event) {
+	for _, e := range events {
+		r.Markers = append(r.Markers, marker{
+			Offset:    e.Time.Sub(r.Start).Seconds(),
+			Direction: e.Direction,
+			Line:      e.Line,
+		})
+	}
+}
+
+// analyzeCapture computes the power metrics of the capture and stores them
+// in the result
+func (r *recordingResult) analyzeCapture(threshold float64, events []serial.Event, pulses []syncPulse) error {
+	c, err := capture.Open(r.Capture)
+	if err != nil {
+		log.Println("Error opening capture:", err)
+		return err
+	}
+	m, err := c.Metrics(threshold)
+	if err != nil {
+		log.Println("Error computing metrics:", err)
+		return err
+	}
+	r.Metrics = &m
+	log.Println("Power:", m)
+
+	if voltage := c.Find(capture.MainVoltage); voltage != nil && voltage.Len() > 0 {
+		r.MinVoltage = voltage.Values[0]
+		for _, v := range voltage.Values {
+			if v < r.MinVoltage {
+				r.MinVoltage = v
+			}
+		}
+		log.Printf("Minimum main voltage: %.3f V", r.MinVoltage)
+	}
+
+	phases, err := c.Segment(capture.DefaultSegmentOptions)
+	if err != nil {
+		log.Println("Error segmenting capture:", err)
+		return err
+	}
+	r.Phases = phases
+	r.PhaseTotal = capture.Summarize(phases)
+	for _, p := range phases {
+		log.Println("Phase:", p)
+	}
+	for _, t := range r.PhaseTotal {
+		log.Printf("Total %s: %d phases, %v, %.4f J, %.5f mAh", t.State, t.Count, t.Duration, t.Energy, t.Charge)
+	}
+
+	r.alignSyncPulses(c, pulses)
+	r.attributeCommands(c, events)
+	return nil
+}
+
+// attributeCommands aligns the serial events, the markers of the recording,
+// with the capture and splits the energy between the AT commands. The events
+// are looked up in the capture by wall time, corrected by the sync pulse
+// clock offset if there is one.
+func (r *recordingResult) attributeCommands(c *capture.Capture, events []serial.Event) {
+	if len(c.Recordings) == 0 {
+		return
+	}
+	captureStart := c.Recordings[0].Start
+	current := c.Find(capture.MainCurrent)
+	offset := duration(r.ClockOffset)
+	for i := range r.Markers {
+		r.Markers[i].CaptureOffset = events[i].Time.Round(0).Add(offset).Sub(captureStart).Seconds()
+	}
+	if current == nil {
+		return
+	}
+
+	var commands []serial.Event
+	for _, e := range events {
+		if e.Direction == serial.Command {
+			commands = append(commands, e)
+		}
+	}
+	for i, cmd := range commands {
+		from := cmd.Time.Round(0).Add(offset)
+		to := current.End()
+		if i+1 < len(commands) {
+			to = commands[i+1].Time.Round(0).Add(offset)
+		}
+		if from.Before(captureStart) || !from.Before(current.End()) {
+			continue
+		}
+		m, err := c.MetricsBetween(from, to, 0)
+		if err != nil {
+			continue
+		}
+		ce := commandEnergy{
+			Command:  cmd.Line,
+			Offset:   from.Sub(captureStart).Seconds(),
+			Duration: to.Sub(from).Seconds(),
+			Energy:   m.Energy,
+			Charge:   m.Charge,
+		}
+		r.Commands = append(r.Commands, ce)
+		log.Printf("Command %s at %.3f s: %.3f s, %.4f J, %.5f mAh", ce.Command, ce.Offset, ce.Duration, ce.Energy, ce.Charge)
+	}
+}
+
+// duration converts seconds to a time.Duration
+func duration(seconds float64) time.Duration {
+	return time.Duration(math.Round(seconds * float64(time.Second)))
+}
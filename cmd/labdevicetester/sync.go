@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/devicefamily"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/otii/capture"
+)
+
+// syncChannel is the Otii digital input the sync GPIO is wired to
+const syncChannel = "i1"
+
+// syncPulse is a pulse on the sync GPIO at a test phase boundary
+type syncPulse struct {
+	Label string `json:"label"`
+	// Host is the host time of the rising edge, halfway between the command
+	// and the module's response
+	Host time.Time `json:"host"`
+	// Capture is the rising edge in the capture, zero if it wasn't found
+	Capture time.Time `json:"capture"`
+}
+
+// syncer emits sync pulses on a module GPIO wired to the Otii digital input,
+// so that the timeline can be lined up with the capture to well below the
+// accuracy of the wall clocks
+type syncer struct {
+	d      devicefamily.Interface
+	pin    int
+	pulses []syncPulse
+}
+
+// newSyncer returns nil if pin is negative. A nil syncer emits no pulses.
+func newSyncer(d devicefamily.Interface, pin int) *syncer {
+	if pin < 0 {
+		return nil
+	}
+	return &syncer{d: d, pin: pin}
+}
+
+func (s *syncer) configure() bool {
+	if s == nil {
+		return true
+	}
+	return s.d.ConfigureGPIO(s.pin)
+}
+
+// pulse emits a pulse labelled with the phase starting
+func (s *syncer) pulse(label string) {
+	if s == nil {
+		return
+	}
+	before := time.Now()
+	if !s.d.SetGPIO(s.pin, true) {
+		return
+	}
+	after := time.Now()
+	s.d.SetGPIO(s.pin, false)
+	s.pulses = append(s.pulses, syncPulse{Label: label, Host: before.Add(after.Sub(before) / 2)})
+}
+
+// reset forgets the pulses emitted, e.g. for a new recording
+func (s *syncer) reset() {
+	if s != nil {
+		s.pulses = nil
+	}
+}
+
+// emitted returns the pulses emitted so far
+func (s *syncer) emitted() []syncPulse {
+	if s == nil {
+		return nil
+	}
+	return s.pulses
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// alignSyncPulses matches the pulses with the rising edges on the sync
+// channel and sets the clock offset between the host and the capture to the
+// median offset of the pulses
+func (r *recordingResult) alignSyncPulses(c *capture.Capture, pulses []syncPulse) {
+	if len(pulses) == 0 {
+		return
+	}
+	gpi := c.Find(capture.GPI1)
+	if gpi == nil {
+		log.Println("Sync channel not recorded, using wall clock alignment")
+		return
+	}
+	edges := gpi.RisingEdges()
+	if len(edges) != len(pulses) {
+		log.Printf("Found %d sync edges for %d pulses, using wall clock alignment", len(edges), len(pulses))
+		return
+	}
+	offsets := make([]time.Duration, len(pulses))
+	for i := range pulses {
+		pulses[i].Capture = edges[i]
+		offsets[i] = edges[i].Sub(pulses[i].Host.Round(0))
+	}
+	r.SyncPulses = pulses
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	r.ClockOffset = offsets[len(offsets)/2].Seconds()
+	log.Printf("Capture clock offset to host: %v (%v to %v)", offsets[len(offsets)/2], offsets[0], offsets[len(offsets)-1])
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/devicefamily"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/otii"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/scenario"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/serial"
+)
+
+// tester implements the scenario steps with the device and the Otii
+type tester struct {
+	device   devicefamily.Interface
+	timeline *serial.Timeline
+	syncs    *syncer
+	plan     testPlan
+	result   *runResult
+
+	apn     string
+	auth    devicefamily.PDPAuth
+	network networkSelection
+	// server is the server hostname or IP address, resolved by Resolve
+	server string
+	port   int
+	// socket is the socket the current packet is sent on, -1 if none
+	socket int
+
+	threshold float64
+	// analyze is false when there are no captures to analyze
+	analyze bool
+
+	// attached is when the module was attached by a configure step that
+	// rebooted it, zero if it hasn't been
+	attached time.Time
+
+	// knownResets are the resets before the recording, which are expected
+	knownResets int
+	recording   bool
+}
+
+func (t *tester) Configure(step scenario.Step) error {
+	d := t.device
+	if step.Reboot {
+		if !clean(d, t.apn, t.auth, t.network) {
+			return errors.New("clean failed")
+		}
+		t.attached = time.Now()
+	}
+	if step.PSM != nil {
+		enabled := uint8(0)
+		if step.PSM.Enabled {
+			enabled = 1
+		}
+		if !d.PowerSaveMode(enabled, step.PSM.TAU, step.PSM.ActiveTime) {
+			return errors.New("configuring PSM failed")
+		}
+	}
+	if step.DisableEDRX && !d.DisableEDRX() {
+		return errors.New("disabling eDRX failed")
+	}
+	if step.EDRX != nil {
+		if step.EDRX.Enabled && !d.SetEDRX(step.EDRX.Cycle) {
+			return errors.New("configuring eDRX failed")
+		}
+		if !step.EDRX.Enabled && !d.DisableEDRX() {
+			return errors.New("disabling eDRX failed")
+		}
+	}
+	if step.Radio != "" {
+		radio, _ := devicefamily.ParseRadio(step.Radio)
+		if !d.SetRadio(radio) {
+			return errors.New("setting the radio functionality failed")
+		}
+	}
+	return nil
+}
+
+func (t *tester) WaitForRegistration(ctx context.Context, timeout time.Duration) error {
+	start := time.Now()
+	if err := scenario.SleepContext(ctx, time.Second*5); err != nil {
+		return err
+	}
+
+	failCount := 0
+	for {
+		status, err := t.device.RegistrationStatus()
+		if err != nil {
+			log.Println("Status failed")
+			failCount++
+			if failCount > 5 {
+				return exitError{exitDevice, err}
+			}
+		}
+		if status == 1 {
+			if !t.attached.IsZero() {
+				t.result.RegistrationTime = time.Since(t.attached).Seconds()
+				t.attached = time.Time{}
+			}
+			break
+		}
+		if timeout > 0 && time.Since(start) > timeout {
+			return exitError{exitDevice, fmt.Errorf("not registered after %v", timeout)}
+		}
+		log.Println("Not connected... status:", status)
+		if err := scenario.SleepContext(ctx, time.Second); err != nil {
+			return err
+		}
+	}
+
+	if addr, err := t.device.PDPAddress(t.device.DefaultContextID()); err == nil {
+		log.Printf("IP address: %s DNS: %s", addr.IP, strings.Join(addr.DNS, ", "))
+	}
+
+	// The module clock offset lets module side events be lined up with the
+	// Otii capture and the UDP server log
+	if nt, err := t.device.NetworkTime(); err == nil {
+		log.Printf("Module clock offset to host: %v", nt.Offset)
+	}
+	if nt, ok := t.device.LastNITZ(); ok {
+		log.Printf("NITZ offset to host: %v", nt.Offset)
+	}
+	return nil
+}
+
+func (t *tester) StartRecording(ctx context.Context, duration time.Duration) (func() error, error) {
+	// Any reset from here on is unexpected, e.g. a brown-out
+	t.knownResets = len(t.device.Resets())
+
+	// Later recordings of the scenario are numbered so that their captures
+	// don't overwrite the first
+	r := t.result
+	name := r.Scenario
+	if n := len(r.Recordings); n > 0 {
+		name = fmt.Sprintf("%s-%d", name, n+1)
+	}
+	rec := &recordingResult{
+		Capture: t.plan.Measurement.CaptureFilename(map[string]string{"type": r.DeviceType, "scenario": name}),
+		Start:   time.Now(),
+	}
+	r.Recordings = append(r.Recordings, rec)
+	t.syncs.reset()
+	recording := record(t.plan.Measurement, duration, rec.Capture)
+	t.recording = true
+
+	// An interrupted recording is stopped early, and the partial capture is
+	// saved and analyzed as usual. Stop is repeated in case the recording
+	// hadn't started yet.
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping the recording")
+		case <-done:
+			return
+		}
+		for {
+			otii.Stop()
+			select {
+			case <-done:
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}()
+
+	return func() error {
+		err := <-recording
+		close(done)
+		t.recording = false
+		if err != nil {
+			log.Println("Error recording:", err)
+			return exitError{exitOtii, err}
+		}
+		if !r.checkResets(t.device, t.knownResets) {
+			return errors.New("module reset during recording")
+		}
+		events := t.timeline.Since(rec.Start)
+		rec.addMarkers(events)
+		if t.analyze {
+			if err := rec.analyzeCapture(t.threshold, events, t.syncs.emitted()); err != nil {
+				return exitError{exitOtii, err}
+			}
+		}
+		return nil
+	}, nil
+}
+
+func (t *tester) Resolve() error {
+	if net.ParseIP(t.server) != nil {
+		return nil
+	}
+	ip, err := t.device.ResolveHostname(t.server)
+	if err != nil {
+		return err
+	}
+	t.server = ip
+	return nil
+}
+
+func (t *tester) OpenSocket(step scenario.Step) error {
+	t.socket = -1
+	if err := t.Resolve(); err != nil {
+		return err
+	}
+	d := t.device
+	if step.Protocol == "tcp" {
+		socket, err := d.CreateSocket("TCP", t.port)
+		if err != nil {
+			return err
+		}
+		t.socket = socket
+		if !d.ConnectSocket(socket, t.server, t.port) {
+			return errors.New("connect failed")
+		}
+		return nil
+	}
+
+	socket, err := d.CreateSocket("UDP", t.port)
+	if err != nil {
+		return err
+	}
+	t.socket = socket
+	if step.Type == scenario.SendAndReceive {
+		time.Sleep(1 * time.Second)
+	}
+	return nil
+}
+
+func (t *tester) CloseSocket() {
+	if t.socket >= 0 {
+		t.device.CloseSocket(t.socket)
+		t.socket = -1
+	}
+}
+
+func (t *tester) Send(step scenario.Step) error {
+	d := t.device
+	if step.Protocol == "tcp" {
+		if !d.SendTCP(t.socket, step.Payload()) {
+			return t.sendFailed()
+		}
+		t.packetSent()
+		return nil
+	}
+
+	if !d.SendUDP(t.socket, t.server, t.port, step.SendFlag(), step.Payload()) {
+		return t.sendFailed()
+	}
+	t.packetSent()
+	return nil
+}
+
+func (t *tester) SendAndReceive(step scenario.Step) error {
+	d := t.device
+	// The server echoes messages starting with "echo "
+	payload := append([]byte("echo "), step.Payload()...)
+	sent := time.Now()
+	if !d.SendUDP(t.socket, t.server, t.port, step.SendFlag(), payload) {
+		return t.sendFailed()
+	}
+	t.packetSent()
+	if _, err := d.ReceiveUDP(t.socket, len(payload)); err != nil {
+		return fmt.Errorf("receiving: %v", err)
+	}
+	t.result.PacketsEchoed++
+	t.result.RoundTrips = append(t.result.RoundTrips, time.Since(sent).Seconds())
+	return nil
+}
+
+// packetSent counts a packet, in the recording too if there is one
+func (t *tester) packetSent() {
+	t.result.PacketsSent++
+	if t.recording {
+		t.result.lastRecording().PacketsSent++
+	}
+}
+
+func (t *tester) sendFailed() error {
+	if t.recording && !t.result.checkResets(t.device, t.knownResets) {
+		return errors.New("module reset during transmission")
+	}
+	return errors.New("send failed")
+}
+
+func (t *tester) Mark(label string) {
+	if t.recording {
+		t.syncs.pulse(label)
+	}
+}
+
+// Metric returns a metric of the last recording for assert steps
+func (t *tester) Metric(name string) (float64, error) {
+	if name == "resets" {
+		if !t.device.DetectsResets() {
+			return 0, errors.New("resets aren't detected on this device")
+		}
+		return float64(len(t.result.Resets)), nil
+	}
+	r := t.result.lastRecording()
+	if r == nil || r.Metrics == nil {
+		return 0, fmt.Errorf("no metrics for %s, nothing recorded", name)
+	}
+	switch name {
+	case "energy_j":
+		return r.Metrics.Energy, nil
+	case "charge_mah":
+		return r.Metrics.Charge, nil
+	case "average_current_a":
+		return r.Metrics.AverageCurrent, nil
+	case "peak_current_a":
+		return r.Metrics.PeakCurrent, nil
+	case "min_current_a":
+		return r.Metrics.MinCurrent, nil
+	case "time_above_threshold_s":
+		return r.Metrics.TimeAboveThreshold, nil
+	case "min_voltage_v":
+		return r.MinVoltage, nil
+	}
+	return 0, fmt.Errorf("unknown metric %q", name)
+}
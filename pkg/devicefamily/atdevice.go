@@ -4,8 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ExploratoryEngineering/labdevicetester/pkg/serial"
 )
@@ -13,48 +17,127 @@ import (
 type ATDeviceSpec struct {
 	BaudRate int
 	Reboot   string
-	Radio    string
+	// BootURC is the prefix of the line printed when the module has booted
+	BootURC string
+	Radio   string
+	// RadioModes maps each supported radio functionality to its +CFUN
+	// parameter. Modes missing from the map are not supported.
+	RadioModes map[RadioFunctionality]string
 	// DisableAutoConnect string
 	// EnableAutoConnect  string
-	FirmwareVersion           string
-	ConfigAPN                 string
-	AutoOperatorSelection     string
-	RegistrationStatus        string
-	PSM                       string
-	DisableEDRX               string
+	FirmwareVersion string
+	ConfigAPN       string
+	// ContextID is the default PDP context used by ConfigAPN
+	ContextID               int
+	ListPDPContexts         string
+	DefinePDPContext        string
+	ActivatePDPContext      string
+	PDPAddress              string
+	PDPDynamicParameters    string
+	PDPAuth                 string
+	AutoOperatorSelection   string
+	ManualOperatorSelection string
+	OperatorScan            string
+	SelectRAT               string
+	// RATs maps each supported RAT to its SelectRAT parameter. Single RAT
+	// devices map their RAT to an empty parameter.
+	RATs map[RAT]string
+	// RebootRAT is the RAT used after Reboot
+	RebootRAT RAT
+	// EDRXRATs maps each RAT to the access technology parameter of
+	// DisableEDRX and EDRX
+	EDRXRATs map[RAT]string
+	// Bands takes a comma separated list of bands
+	Bands string
+	// BandMask takes a BandMaskRATs parameter and a bitmask of bands
+	BandMask           string
+	BandMaskRATs       map[RAT]string
+	RegistrationStatus string
+	PSM                string
+	DisableEDRX        string
+	EDRX               string
+	ResolveHostname    string
+	Clock              string
+	TimeZoneReporting  string
+	// TimeZoneURC is the NITZ URC enabled by TimeZoneReporting. +CTZEU
+	// reports UTC, +CTZE reports local time.
+	TimeZoneURC               string
 	CreateUDPSocket           string
 	CreateTCPSocket           string
 	CloseSocket               string
 	SendUDP                   string
+	ConnectSocket             string
+	SendTCP                   string
 	ReceiveUDP                string
 	ReceivedMessageIndication string
+
+	// GPIOConfig configures a pin as an output, GPIOWrite sets its level
+	GPIOConfig string
+	GPIOWrite  string
 }
 
 type ATdevicefamily struct {
 	s    *serial.SerialConnection
 	spec ATDeviceSpec
+	// rat is the RAT in use, see SetRAT
+	rat RAT
+
+	nitzMutex sync.Mutex
+	nitz      *NetworkTime
+
+	resetMutex sync.Mutex
+	resets     []Reset
 }
 
 func New(spec ATDeviceSpec) *ATdevicefamily {
 	at := ATdevicefamily{}
 	at.spec = spec
+	at.rat = spec.RebootRAT
 	return &at
 }
 
 func (t *ATdevicefamily) Init(s *serial.SerialConnection) {
 	t.s = s
+	if t.spec.TimeZoneURC != "" {
+		s.HandleURC(t.spec.TimeZoneURC, t.handleNITZ)
+	}
+	if t.spec.BootURC != "" {
+		s.HandleURC(t.spec.BootURC, t.handleBoot)
+	}
+}
+
+func (t *ATdevicefamily) handleBoot(line string) {
+	t.resetMutex.Lock()
+	t.resets = append(t.resets, Reset{Time: time.Now(), Line: line})
+	t.resetMutex.Unlock()
+}
+
+// Resets returns the boot URCs seen since Init. Devices without a boot URC
+// never report any.
+func (t *ATdevicefamily) Resets() []Reset {
+	t.resetMutex.Lock()
+	defer t.resetMutex.Unlock()
+	return append([]Reset(nil), t.resets...)
+}
+
+// DetectsResets returns true if the device reports resets with a boot URC.
+// The SARA-R4 has none, so a brown-out goes unnoticed until a command fails.
+func (t *ATdevicefamily) DetectsResets() bool {
+	return t.spec.BootURC != ""
 }
 
 func (t *ATdevicefamily) BaudRate() int {
 	return t.spec.BaudRate
 }
 
-func (t *ATdevicefamily) FirmwareVersion() {
+func (t *ATdevicefamily) FirmwareVersion() (string, error) {
 	log.Printf("Firmware version")
-	_, _, err := t.s.SendAndReceive(t.spec.FirmwareVersion)
+	lines, _, err := t.s.SendAndReceive(t.spec.FirmwareVersion)
 	if err != nil {
 		log.Printf("Error: %v", err)
+		return "", err
 	}
+	return strings.Join(lines, " "), nil
 }
 
 func (t *ATdevicefamily) IMEI() (int, error) {
@@ -64,8 +147,13 @@ func (t *ATdevicefamily) IMEI() (int, error) {
 		return 0, err
 	}
 
-	imei := strings.Split(urcs[0], ": ")[1]
-	return strconv.Atoi(imei)
+	for _, urc := range urcs {
+		if strings.HasPrefix(urc, "+CGSN: ") {
+			return strconv.Atoi(strings.TrimPrefix(urc, "+CGSN: "))
+		}
+	}
+	log.Println("Error: +CGSN response not found")
+	return 0, errors.New("+CGSN response not found")
 }
 
 func (t *ATdevicefamily) IMSI() (int, error) {
@@ -74,6 +162,10 @@ func (t *ATdevicefamily) IMSI() (int, error) {
 		log.Printf("Error: %v", err)
 		return 0, err
 	}
+	if len(lines) == 0 {
+		log.Println("Error: IMSI not found")
+		return 0, errors.New("IMSI not found")
+	}
 	return strconv.Atoi(lines[0])
 }
 
@@ -91,10 +183,55 @@ func (t *ATdevicefamily) RebootModule() bool {
 		log.Printf("Error rebooting: %v", strings.Join(res, " | "))
 		return false
 	}
+	t.rat = t.spec.RebootRAT
 	log.Println("Rebooted OK")
 	return true
 }
 
+func (t *ATdevicefamily) WaitForBoot() (Boot, error) {
+	var boot Boot
+	if t.spec.BootURC != "" {
+		log.Println("Waiting for boot URC...")
+		if _, err := t.s.WaitForURC(t.spec.BootURC); err != nil {
+			log.Printf("Error waiting for boot URC: %v", err)
+			return boot, err
+		}
+		boot.URC = time.Now()
+	}
+
+	// The AT commands are polled with a short read timeout so that the
+	// first response is timed closely
+	log.Println("Waiting for AT response...")
+	if err := t.s.SetReadTimeout(bootPollTimeout); err != nil {
+		log.Printf("Error: %v", err)
+		return boot, err
+	}
+	defer func() {
+		if err := t.s.SetReadTimeout(serial.ReadTimeout); err != nil {
+			log.Printf("Error: %v", err)
+		}
+	}()
+	var err error
+	for start := time.Now(); time.Since(start) < bootTimeout; {
+		if _, _, err = t.s.SendAndReceive("AT"); err == nil {
+			boot.FirstAT = time.Now()
+			log.Println("Device booted")
+			return boot, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	log.Printf("Error: device not responding after boot: %v", err)
+	return boot, err
+}
+
+const (
+	// bootPollTimeout is the read timeout of the AT commands polling a
+	// booting module
+	bootPollTimeout = 200 * time.Millisecond
+	// bootTimeout is how long the module has to respond after boot
+	bootTimeout = 20 * time.Second
+)
+
 func (t *ATdevicefamily) SetAPN(apn string) bool {
 	log.Printf("Set APN to %s...", apn)
 	_, _, err := t.s.SendAndReceive(fmt.Sprintf(t.spec.ConfigAPN, apn))
@@ -105,16 +242,154 @@ func (t *ATdevicefamily) SetAPN(apn string) bool {
 	return true
 }
 
+func (t *ATdevicefamily) DefaultContextID() int {
+	return t.spec.ContextID
+}
+
+func (t *ATdevicefamily) PDPContexts() ([]PDPContext, error) {
+	log.Println("List PDP contexts...")
+	_, urcs, err := t.s.SendAndReceive(t.spec.ListPDPContexts)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return nil, err
+	}
+	var contexts []PDPContext
+	for _, urc := range urcs {
+		if !strings.HasPrefix(urc, "+CGDCONT: ") {
+			continue
+		}
+		params := splitParams(strings.TrimPrefix(urc, "+CGDCONT: "))
+		if len(params) < 3 {
+			continue
+		}
+		cid, err := strconv.Atoi(params[0])
+		if err != nil {
+			log.Printf("Error parsing context id: %v", err)
+			return nil, err
+		}
+		ctx := PDPContext{CID: cid, Type: params[1], APN: params[2]}
+		if len(params) > 3 {
+			ctx.Address = params[3]
+		}
+		contexts = append(contexts, ctx)
+	}
+	return contexts, nil
+}
+
+func (t *ATdevicefamily) DefinePDPContext(ctx PDPContext) bool {
+	log.Printf("Define PDP context %d (%s) with APN %s...", ctx.CID, ctx.Type, ctx.APN)
+	_, _, err := t.s.SendAndReceive(fmt.Sprintf(t.spec.DefinePDPContext, ctx.CID, ctx.Type, ctx.APN))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return false
+	}
+	return true
+}
+
+func (t *ATdevicefamily) SetPDPAuth(cid int, auth PDPAuth) bool {
+	log.Printf("Set PDP context %d authentication...", cid)
+	if t.spec.PDPAuth == "" {
+		log.Println("Error: device does not implement PDP authentication")
+		return false
+	}
+	cmd := fmt.Sprintf(t.spec.PDPAuth, cid, int(auth.Protocol), auth.Username, auth.Password)
+	redacted := fmt.Sprintf(t.spec.PDPAuth, cid, int(auth.Protocol), auth.Username, "***")
+	_, _, err := t.s.SendAndReceiveRedacted(cmd, redacted)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return false
+	}
+	return true
+}
+
+func (t *ATdevicefamily) ActivatePDPContext(cid int) bool {
+	log.Printf("Activate PDP context %d...", cid)
+	return t.setPDPContextState(cid, 1)
+}
+
+func (t *ATdevicefamily) DeactivatePDPContext(cid int) bool {
+	log.Printf("Deactivate PDP context %d...", cid)
+	return t.setPDPContextState(cid, 0)
+}
+
+func (t *ATdevicefamily) setPDPContextState(cid, state int) bool {
+	_, _, err := t.s.SendAndReceive(fmt.Sprintf(t.spec.ActivatePDPContext, state, cid))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return false
+	}
+	return true
+}
+
+func (t *ATdevicefamily) PDPAddress(cid int) (PDPAddress, error) {
+	log.Printf("PDP context %d address...", cid)
+	addr := PDPAddress{CID: cid}
+	_, urcs, err := t.s.SendAndReceive(fmt.Sprintf(t.spec.PDPAddress, cid))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return addr, err
+	}
+	for _, urc := range urcs {
+		if !strings.HasPrefix(urc, "+CGPADDR: ") {
+			continue
+		}
+		params := splitParams(strings.TrimPrefix(urc, "+CGPADDR: "))
+		if len(params) > 1 {
+			addr.IP = params[1]
+		}
+	}
+	if addr.IP == "" {
+		return addr, errors.New("+CGPADDR response not found")
+	}
+
+	if t.spec.PDPDynamicParameters == "" {
+		return addr, nil
+	}
+	_, urcs, err = t.s.SendAndReceive(fmt.Sprintf(t.spec.PDPDynamicParameters, cid))
+	if err != nil {
+		log.Printf("Error reading DNS servers: %v", err)
+		return addr, err
+	}
+	for _, urc := range urcs {
+		if !strings.HasPrefix(urc, "+CGCONTRDP: ") {
+			continue
+		}
+		// <cid>,<bearer_id>,<apn>,<local_addr>,<gw_addr>,<dns_prim>,<dns_sec>,...
+		params := splitParams(strings.TrimPrefix(urc, "+CGCONTRDP: "))
+		for i := 5; i < 7 && i < len(params); i++ {
+			if params[i] != "" {
+				addr.DNS = append(addr.DNS, params[i])
+			}
+		}
+	}
+	return addr, nil
+}
+
+// splitParams splits a comma separated AT response, keeping commas inside
+// quoted strings and stripping the quotes
+func splitParams(s string) []string {
+	var params []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			params = append(params, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	return append(params, current.String())
+}
+
 func (t *ATdevicefamily) SetRadio(fun RadioFunctionality) bool {
-	log.Println("Radio functionality")
-	radioFun := ""
-	switch fun {
-	case RadioOff:
-		radioFun = "0"
-	case RadioFull:
-		radioFun = "1"
-	default:
-		log.Fatalln("Radio functionality not implemented")
+	log.Printf("Radio functionality %v", fun)
+	radioFun, ok := t.spec.RadioModes[fun]
+	if !ok {
+		log.Printf("Error: radio functionality %v not supported by device", fun)
 		return false
 	}
 	cmd := fmt.Sprintf(t.spec.Radio, radioFun)
@@ -136,6 +411,106 @@ func (t *ATdevicefamily) AutoOperatorSelection() bool {
 	return true
 }
 
+func (t *ATdevicefamily) ManualOperatorSelection(plmn string) bool {
+	log.Printf("Manual operator selection %s...", plmn)
+	if t.spec.ManualOperatorSelection == "" {
+		log.Println("Error: device does not implement manual operator selection")
+		return false
+	}
+	_, _, err := t.s.SendAndReceive(fmt.Sprintf(t.spec.ManualOperatorSelection, plmn))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return false
+	}
+	return true
+}
+
+var operatorPattern = regexp.MustCompile(`\((\d+),"([^"]*)","([^"]*)","(\d+)"(?:,(\d+))?\)`)
+
+func (t *ATdevicefamily) ScanOperators() ([]Operator, error) {
+	log.Println("Scanning operators...")
+	if t.spec.OperatorScan == "" {
+		return nil, errors.New("device does not implement operator scan")
+	}
+	_, urcs, err := t.s.SendAndReceive(t.spec.OperatorScan)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return nil, err
+	}
+	var operators []Operator
+	for _, urc := range urcs {
+		if !strings.HasPrefix(urc, "+COPS") {
+			continue
+		}
+		for _, m := range operatorPattern.FindAllStringSubmatch(urc, -1) {
+			op := Operator{LongName: m[2], ShortName: m[3], PLMN: m[4]}
+			op.Status, _ = strconv.Atoi(m[1])
+			if m[5] != "" {
+				op.AccessTechnology, _ = strconv.Atoi(m[5])
+			}
+			operators = append(operators, op)
+		}
+	}
+	return operators, nil
+}
+
+func (t *ATdevicefamily) SetRAT(rat RAT) bool {
+	log.Printf("Select RAT %v...", rat)
+	param, ok := t.spec.RATs[rat]
+	if !ok {
+		log.Printf("Error: RAT %v not supported by device", rat)
+		return false
+	}
+	if param == "" {
+		log.Printf("Device only supports %v", rat)
+		return true
+	}
+	_, _, err := t.s.SendAndReceive(fmt.Sprintf(t.spec.SelectRAT, param))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return false
+	}
+	t.rat = rat
+	return true
+}
+
+func (t *ATdevicefamily) SetBands(rat RAT, bands []int) bool {
+	log.Printf("Set %v bands to %v...", rat, bands)
+	var cmd string
+	switch {
+	case t.spec.Bands != "":
+		list := make([]string, len(bands))
+		for i, b := range bands {
+			list[i] = strconv.Itoa(b)
+		}
+		cmd = fmt.Sprintf(t.spec.Bands, strings.Join(list, ","))
+	case t.spec.BandMask != "":
+		param, ok := t.spec.BandMaskRATs[rat]
+		if !ok {
+			log.Printf("Error: band mask for RAT %v not supported by device", rat)
+			return false
+		}
+		var mask uint64
+		for _, b := range bands {
+			if b < 1 || b > 64 {
+				log.Printf("Error: band %d out of range for band mask", b)
+				return false
+			}
+			mask |= 1 << uint(b-1)
+		}
+		cmd = fmt.Sprintf(t.spec.BandMask, param, mask)
+	default:
+		log.Println("Error: device does not implement band selection")
+		return false
+	}
+	_, _, err := t.s.SendAndReceive(cmd)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return false
+	}
+	return true
+}
+
 func (t *ATdevicefamily) RegistrationStatus() (int, error) {
 	log.Println("Registration status...")
 	_, urcs, err := t.s.SendAndReceive(t.spec.RegistrationStatus)
@@ -147,8 +522,11 @@ func (t *ATdevicefamily) RegistrationStatus() (int, error) {
 		if strings.Index(urc, "+CEREG") != 0 {
 			continue
 		}
-		status := strings.Split(urc, ",")[1]
-		return strconv.Atoi(status)
+		params := strings.Split(urc, ",")
+		if len(params) < 2 {
+			continue
+		}
+		return strconv.Atoi(params[1])
 	}
 	log.Println("Error: +CEREG response not found")
 	return 0, errors.New("+CEREG response not found")
@@ -190,8 +568,13 @@ func (t *ATdevicefamily) PowerSaveMode(enabled, tau, activeTime uint8) bool {
 }
 
 func (t *ATdevicefamily) DisableEDRX() bool {
-	log.Println("Disabling eDRX...")
-	_, _, err := t.s.SendAndReceive(t.spec.DisableEDRX)
+	log.Printf("Disabling %v eDRX...", t.rat)
+	act, ok := t.spec.EDRXRATs[t.rat]
+	if !ok {
+		log.Printf("Error: eDRX for RAT %v not supported by device", t.rat)
+		return false
+	}
+	_, _, err := t.s.SendAndReceive(fmt.Sprintf(t.spec.DisableEDRX, act))
 	if err != nil {
 		log.Printf("Error: %v", err)
 		return false
@@ -200,23 +583,213 @@ func (t *ATdevicefamily) DisableEDRX() bool {
 	return true
 }
 
-func (t *ATdevicefamily) CreateSocket(protocol string, listenPort int) (int, error) {
-	log.Printf("Create socket")
+func (t *ATdevicefamily) SetEDRX(cycle uint8) bool {
+	log.Printf("%v eDRX... cycle %04b", t.rat, cycle)
+	if t.spec.EDRX == "" {
+		log.Println("Error: device does not implement eDRX")
+		return false
+	}
+	act, ok := t.spec.EDRXRATs[t.rat]
+	if !ok {
+		log.Printf("Error: eDRX for RAT %v not supported by device", t.rat)
+		return false
+	}
+	cmd := fmt.Sprintf(t.spec.EDRX, act, cycle)
+	log.Println(cmd)
+	_, _, err := t.s.SendAndReceive(cmd)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return false
+	}
+	log.Println("eDRX configured")
+	return true
+}
 
-	var cmd string
+// ConfigureGPIO makes pin an output, initially low, e.g. for sync pulses to
+// the Otii digital inputs
+func (t *ATdevicefamily) ConfigureGPIO(pin int) bool {
+	log.Printf("Configuring GPIO %d as output...", pin)
+	if t.spec.GPIOConfig == "" {
+		log.Println("Error: device does not implement GPIO")
+		return false
+	}
+	_, _, err := t.s.SendAndReceive(fmt.Sprintf(t.spec.GPIOConfig, pin))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return false
+	}
+	return true
+}
+
+// SetGPIO sets the level of an output pin
+func (t *ATdevicefamily) SetGPIO(pin int, high bool) bool {
+	if t.spec.GPIOWrite == "" {
+		log.Println("Error: device does not implement GPIO")
+		return false
+	}
+	level := 0
+	if high {
+		level = 1
+	}
+	_, _, err := t.s.SendAndReceive(fmt.Sprintf(t.spec.GPIOWrite, pin, level))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return false
+	}
+	return true
+}
+
+func (t *ATdevicefamily) EnableNITZ() bool {
+	log.Println("Enabling NITZ reporting...")
+	if t.spec.TimeZoneReporting == "" {
+		log.Println("Error: device does not implement time zone reporting")
+		return false
+	}
+	_, _, err := t.s.SendAndReceive(t.spec.TimeZoneReporting)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return false
+	}
+	return true
+}
+
+func (t *ATdevicefamily) NetworkTime() (NetworkTime, error) {
+	log.Println("Network time...")
+	before := time.Now()
+	_, urcs, err := t.s.SendAndReceive(t.spec.Clock)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return NetworkTime{}, err
+	}
+	// The clock has one second resolution, so the midpoint of the command is
+	// as good an estimate of when it was read as any
+	host := before.Add(time.Since(before) / 2)
+	for _, urc := range urcs {
+		if !strings.HasPrefix(urc, "+CCLK: ") {
+			continue
+		}
+		// "yy/MM/dd,hh:mm:ss±zz" where zz is the time zone in quarter hours
+		value := strings.Trim(strings.TrimPrefix(urc, "+CCLK: "), `"`)
+		if len(value) < 20 {
+			return NetworkTime{}, fmt.Errorf("invalid +CCLK response %q", urc)
+		}
+		loc, err := parseTimeZone(value[17:])
+		if err != nil {
+			return NetworkTime{}, err
+		}
+		moduleTime, err := time.ParseInLocation("06/01/02,15:04:05", value[:17], loc)
+		if err != nil {
+			return NetworkTime{}, err
+		}
+		nt := NetworkTime{Time: moduleTime, Offset: moduleTime.Sub(host), Source: "+CCLK"}
+		log.Printf("Network time %v, offset to host %v", nt.Time, nt.Offset)
+		return nt, nil
+	}
+	log.Println("Error: +CCLK response not found")
+	return NetworkTime{}, errors.New("+CCLK response not found")
+}
+
+func (t *ATdevicefamily) LastNITZ() (NetworkTime, bool) {
+	t.nitzMutex.Lock()
+	defer t.nitzMutex.Unlock()
+	if t.nitz == nil {
+		return NetworkTime{}, false
+	}
+	return *t.nitz, true
+}
+
+// handleNITZ parses +CTZE/+CTZEU URCs on the form <tz>,<dst>,"<time>"
+func (t *ATdevicefamily) handleNITZ(line string) {
+	host := time.Now()
+	i := strings.Index(line, ": ")
+	if i < 0 {
+		return
+	}
+	params := splitParams(line[i+2:])
+	if len(params) < 3 || params[2] == "" {
+		// Time zone update only
+		return
+	}
+	loc := time.UTC
+	if !strings.HasPrefix(line, "+CTZEU") {
+		var err error
+		if loc, err = parseTimeZone(params[0]); err != nil {
+			log.Printf("Error parsing NITZ time zone: %v", err)
+			return
+		}
+	}
+	var networkTime time.Time
+	var err error
+	for _, layout := range []string{"06/01/02,15:04:05", "2006/01/02,15:04:05"} {
+		if networkTime, err = time.ParseInLocation(layout, params[2], loc); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		log.Printf("Error parsing NITZ time: %v", err)
+		return
+	}
+	t.nitzMutex.Lock()
+	t.nitz = &NetworkTime{Time: networkTime, Offset: networkTime.Sub(host), Source: t.spec.TimeZoneURC}
+	t.nitzMutex.Unlock()
+}
+
+// parseTimeZone parses a time zone given as a signed number of quarter hours
+func parseTimeZone(tz string) (*time.Location, error) {
+	quarters, err := strconv.Atoi(strings.TrimPrefix(tz, "+"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q", tz)
+	}
+	return time.FixedZone("", quarters*15*60), nil
+}
+
+func (t *ATdevicefamily) ResolveHostname(hostname string) (string, error) {
+	log.Printf("Resolving %s...", hostname)
+	if t.spec.ResolveHostname == "" {
+		return "", errors.New("device does not implement DNS resolution")
+	}
+	_, urcs, err := t.s.SendAndReceive(fmt.Sprintf(t.spec.ResolveHostname, hostname))
+	if err != nil {
+		log.Printf("Error resolving hostname: %v", err)
+		return "", err
+	}
+	for _, urc := range urcs {
+		i := strings.Index(urc, ": ")
+		if i < 0 {
+			continue
+		}
+		ip := strings.Trim(urc[i+2:], `"`)
+		if net.ParseIP(ip) != nil {
+			log.Printf("Resolved %s to %s", hostname, ip)
+			return ip, nil
+		}
+	}
+	log.Println("Error: DNS response not found")
+	return "", errors.New("DNS response not found")
+}
+
+// SupportsProtocol returns true if sockets can be created for protocol, UDP
+// or TCP
+func (t *ATdevicefamily) SupportsProtocol(protocol string) bool {
 	switch protocol {
 	case "UDP":
-		if t.spec.CreateUDPSocket == "" {
-			log.Fatalf("Error: device does not implement UDP socket")
-		}
-		cmd = fmt.Sprintf(t.spec.CreateUDPSocket, listenPort)
+		return t.spec.CreateUDPSocket != ""
 	case "TCP":
-		if t.spec.CreateTCPSocket == "" {
-			log.Fatalf("Error: device does not implement TCP socket")
-		}
+		return t.spec.CreateTCPSocket != "" && t.spec.ConnectSocket != "" && t.spec.SendTCP != ""
+	}
+	return false
+}
+
+func (t *ATdevicefamily) CreateSocket(protocol string, listenPort int) (int, error) {
+	log.Printf("Create socket")
+
+	if !t.SupportsProtocol(protocol) {
+		log.Printf("Error: device does not implement %s socket", protocol)
+		return 0, fmt.Errorf("%s sockets not supported", protocol)
+	}
+	cmd := fmt.Sprintf(t.spec.CreateUDPSocket, listenPort)
+	if protocol == "TCP" {
 		cmd = fmt.Sprintf(t.spec.CreateTCPSocket, listenPort)
-	default:
-		log.Fatal("protocol not implemented")
 	}
 
 	lines, urcs, err := t.s.SendAndReceive(cmd)
@@ -229,13 +802,13 @@ func (t *ATdevicefamily) CreateSocket(protocol string, listenPort int) (int, err
 	if len(lines) > 0 {
 		socket, err = strconv.Atoi(lines[0])
 		if err != nil {
-			log.Printf("Error parsing socket number", err)
+			log.Printf("Error parsing socket number: %v", err)
 			return 0, err
 		}
-	} else if len(urcs) > 0 && strings.HasPrefix(urcs[0], "+USOCR") {
-		socket, err = strconv.Atoi(urcs[0][8:])
+	} else if len(urcs) > 0 && strings.HasPrefix(urcs[0], "+USOCR: ") {
+		socket, err = strconv.Atoi(strings.TrimPrefix(urcs[0], "+USOCR: "))
 		if err != nil {
-			log.Printf("Error parsing +USOCR socket number", err)
+			log.Printf("Error parsing +USOCR socket number: %v", err)
 			return 0, err
 		}
 	}
@@ -252,7 +825,15 @@ func (t *ATdevicefamily) CloseSocket(socket int) bool {
 	return true
 }
 
-func (t *ATdevicefamily) SendUDP(socket int, ip string, port int, flag SendFlag, data []byte) bool {
+func (t *ATdevicefamily) SendUDP(socket int, host string, port int, flag SendFlag, data []byte) bool {
+	ip := host
+	if net.ParseIP(host) == nil {
+		var err error
+		if ip, err = t.ResolveHostname(host); err != nil {
+			return false
+		}
+	}
+
 	log.Println("Sending UDP packet...")
 
 	cmd := fmt.Sprintf(t.spec.SendUDP, socket, ip, port, flag, len(data), data)
@@ -266,6 +847,49 @@ func (t *ATdevicefamily) SendUDP(socket int, ip string, port int, flag SendFlag,
 	return true
 }
 
+// ConnectSocket connects a TCP socket to host
+func (t *ATdevicefamily) ConnectSocket(socket int, host string, port int) bool {
+	if t.spec.ConnectSocket == "" {
+		log.Println("Error: device does not implement TCP")
+		return false
+	}
+	ip := host
+	if net.ParseIP(host) == nil {
+		var err error
+		if ip, err = t.ResolveHostname(host); err != nil {
+			return false
+		}
+	}
+
+	log.Println("Connecting socket...")
+	_, _, err := t.s.SendAndReceive(fmt.Sprintf(t.spec.ConnectSocket, socket, ip, port))
+	if err != nil {
+		log.Printf("Error connecting socket: %v", err)
+		return false
+	}
+	log.Println("Socket connected")
+	return true
+}
+
+// SendTCP writes data to a connected TCP socket
+func (t *ATdevicefamily) SendTCP(socket int, data []byte) bool {
+	if t.spec.SendTCP == "" {
+		log.Println("Error: device does not implement TCP")
+		return false
+	}
+	log.Println("Sending TCP data...")
+
+	cmd := fmt.Sprintf(t.spec.SendTCP, socket, len(data), data)
+	_, _, err := t.s.SendAndReceive(cmd)
+	if err != nil {
+		log.Printf("Error sending data: %v", err)
+		return false
+	}
+
+	log.Println("Successfully sent data")
+	return true
+}
+
 func (t *ATdevicefamily) ReceiveUDP(socket, expectedBytes int) ([]byte, error) {
 	log.Println("Receiving UDP Packet...")
 
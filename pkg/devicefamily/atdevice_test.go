@@ -0,0 +1,126 @@
+package devicefamily
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTimeZone(t *testing.T) {
+	tests := []struct {
+		tz     string
+		offset int
+		err    bool
+	}{
+		{"+04", 3600, false},
+		{"04", 3600, false},
+		{"-20", -5 * 3600, false},
+		{"+00", 0, false},
+		{"", 0, true},
+		{"+1h", 0, true},
+	}
+	for _, tt := range tests {
+		loc, err := parseTimeZone(tt.tz)
+		if (err != nil) != tt.err {
+			t.Errorf("parseTimeZone(%q) error %v", tt.tz, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if _, offset := time.Date(2019, 3, 29, 0, 0, 0, 0, loc).Zone(); offset != tt.offset {
+			t.Errorf("parseTimeZone(%q) offset %d, want %d", tt.tz, offset, tt.offset)
+		}
+	}
+}
+
+func TestHandleNITZ(t *testing.T) {
+	want := time.Date(2019, 3, 29, 12, 51, 17, 0, time.UTC)
+	tests := []struct {
+		urc  string
+		line string
+		ok   bool
+	}{
+		// SARA-R4 reports the local time with the time zone
+		{"+CTZE", `+CTZE: +04,0,"19/03/29,13:51:17"`, true},
+		// SARA-N2 reports the universal time
+		{"+CTZEU", `+CTZEU: +04,0,"2019/03/29,12:51:17"`, true},
+		{"+CTZEU", `+CTZEU: +04,0,2019/03/29,12:51:17`, false},
+		{"+CTZE", `+CTZE: +04,0`, false},
+		{"+CTZE", `+CTZE: +04,0,""`, false},
+		{"+CTZE", `+CTZE: x,0,"19/03/29,13:51:17"`, false},
+		{"+CTZE", `+CTZE: +04,0,"19-03-29 13:51:17"`, false},
+		{"+CTZE", `+CTZE`, false},
+	}
+	for _, tt := range tests {
+		d := New(ATDeviceSpec{TimeZoneURC: tt.urc})
+		d.handleNITZ(tt.line)
+		nt, ok := d.LastNITZ()
+		if ok != tt.ok {
+			t.Errorf("%s: LastNITZ() ok = %v, want %v", tt.line, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if !nt.Time.Equal(want) {
+			t.Errorf("%s: time %v, want %v", tt.line, nt.Time, want)
+		}
+		if nt.Source != tt.urc {
+			t.Errorf("%s: source %s, want %s", tt.line, nt.Source, tt.urc)
+		}
+	}
+}
+
+func TestNetworkTime(t *testing.T) {
+	tests := []struct {
+		response string
+		time     time.Time
+		err      bool
+	}{
+		{"+CCLK: \"19/03/29,13:51:17+04\"\r\n\r\nOK", time.Date(2019, 3, 29, 12, 51, 17, 0, time.UTC), false},
+		{"+CCLK: \"19/03/29,12:51:17-00\"\r\n\r\nOK", time.Date(2019, 3, 29, 12, 51, 17, 0, time.UTC), false},
+		{"+CCLK: \"19/03/29,08:51:17-16\"\r\n\r\nOK", time.Date(2019, 3, 29, 12, 51, 17, 0, time.UTC), false},
+		{"+CCLK: \"19/03/29,13:51\"\r\n\r\nOK", time.Time{}, true},
+		{"+CCLK: \"19/03/29,13:51:17+xx\"\r\n\r\nOK", time.Time{}, true},
+		{"OK", time.Time{}, true},
+		{"ERROR", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		d, _ := newFakeDevice(ATDeviceSpec{Clock: "AT+CCLK?"}, map[string]string{"AT+CCLK?": tt.response})
+		nt, err := d.NetworkTime()
+		if (err != nil) != tt.err {
+			t.Errorf("%q: error %v", tt.response, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !nt.Time.Equal(tt.time) {
+			t.Errorf("%q: time %v, want %v", tt.response, nt.Time, tt.time)
+		}
+		// The offset is to the host clock, which is years ahead
+		if nt.Offset >= 0 || nt.Source != "+CCLK" {
+			t.Errorf("%q: offset %v, source %s", tt.response, nt.Offset, nt.Source)
+		}
+	}
+}
+
+func TestSplitParams(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{`1,"IP","telenor.iot","10.0.0.5",0,0,0,0`, []string{"1", "IP", "telenor.iot", "10.0.0.5", "0", "0", "0", "0"}},
+		{`0,"IP","telenor.iot",,0,0,,,,,0`, []string{"0", "IP", "telenor.iot", "", "0", "0", "", "", "", "", "0"}},
+		{`1,"a,b"`, []string{"1", "a,b"}},
+		{`0,10.0.0.5`, []string{"0", "10.0.0.5"}},
+		{`""`, []string{""}},
+		{``, []string{""}},
+	}
+	for _, tt := range tests {
+		if got := splitParams(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitParams(%s) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
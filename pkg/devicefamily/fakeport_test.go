@@ -0,0 +1,59 @@
+package devicefamily
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/serial"
+)
+
+// FakePort is a module that echoes the commands written to it and replies
+// with canned responses. It's exported for the tests of the device families.
+type FakePort struct {
+	// Responses are the lines after the echo of each command, "OK" if the
+	// command is missing. An empty response times out.
+	Responses map[string]string
+	// Commands are the commands written, in order
+	Commands []string
+	pending  bytes.Buffer
+}
+
+// NewFakeConnection returns a connection to a FakePort with responses
+func NewFakeConnection(responses map[string]string) (*serial.SerialConnection, *FakePort) {
+	p := &FakePort{Responses: responses}
+	return serial.NewPortConnection(p, false), p
+}
+
+func (p *FakePort) Read(b []byte) (int, error) {
+	if p.pending.Len() == 0 {
+		return 0, io.EOF
+	}
+	return p.pending.Read(b)
+}
+
+func (p *FakePort) Write(b []byte) (int, error) {
+	cmd := strings.TrimSuffix(string(b), "\r\n")
+	p.Commands = append(p.Commands, cmd)
+	p.pending.WriteString(cmd + "\r\r\n")
+	response, ok := p.Responses[cmd]
+	if !ok {
+		response = "OK"
+	}
+	if response != "" {
+		p.pending.WriteString(response + "\r\n")
+	}
+	return len(b), nil
+}
+
+func (p *FakePort) Close() error {
+	return nil
+}
+
+// newFakeDevice returns a device with spec on a FakePort with responses
+func newFakeDevice(spec ATDeviceSpec, responses map[string]string) (*ATdevicefamily, *FakePort) {
+	s, p := NewFakeConnection(responses)
+	d := New(spec)
+	d.Init(s)
+	return d, p
+}
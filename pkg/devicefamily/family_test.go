@@ -0,0 +1,234 @@
+package devicefamily_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/devicefamily"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/devicefamily/saran2"
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/devicefamily/sarar4"
+)
+
+func TestSetRadio(t *testing.T) {
+	families := map[string]func() *devicefamily.ATdevicefamily{
+		"n2": saran2.New,
+		"r4": sarar4.New,
+	}
+	tests := []struct {
+		family string
+		radio  devicefamily.RadioFunctionality
+		// cmd is empty if the family doesn't support the mode
+		cmd string
+	}{
+		{"n2", devicefamily.RadioOff, "AT+CFUN=0"},
+		{"n2", devicefamily.RadioFull, "AT+CFUN=1"},
+		{"n2", devicefamily.RadioAirplane, ""},
+		{"n2", devicefamily.RadioSIMOff, ""},
+		{"n2", devicefamily.RadioSilentReset, ""},
+		{"n2", devicefamily.RadioSilentResetSIM, ""},
+		{"r4", devicefamily.RadioOff, "ATE0;+CFUN=0"},
+		{"r4", devicefamily.RadioFull, "ATE0;+CFUN=1"},
+		{"r4", devicefamily.RadioAirplane, "ATE0;+CFUN=4"},
+		{"r4", devicefamily.RadioSIMOff, "ATE0;+CFUN=19"},
+		{"r4", devicefamily.RadioSilentReset, "ATE0;+CFUN=15"},
+		{"r4", devicefamily.RadioSilentResetSIM, "ATE0;+CFUN=16"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %v", tt.family, tt.radio), func(t *testing.T) {
+			s, p := devicefamily.NewFakeConnection(nil)
+			d := families[tt.family]()
+			d.Init(s)
+			ok := d.SetRadio(tt.radio)
+			if ok != (tt.cmd != "") {
+				t.Fatalf("SetRadio() = %v", ok)
+			}
+			if tt.cmd == "" {
+				if len(p.Commands) != 0 {
+					t.Errorf("sent %q for an unsupported mode", p.Commands)
+				}
+				return
+			}
+			if len(p.Commands) != 1 || p.Commands[0] != tt.cmd {
+				t.Errorf("sent %q, want %q", p.Commands, tt.cmd)
+			}
+		})
+	}
+}
+
+func TestDetectsResets(t *testing.T) {
+	if !saran2.New().DetectsResets() {
+		t.Error("n2 doesn't detect resets")
+	}
+	if sarar4.New().DetectsResets() {
+		t.Error("r4 detects resets without a boot URC")
+	}
+}
+
+func TestParseRadio(t *testing.T) {
+	for f := devicefamily.RadioOff; f <= devicefamily.RadioSilentResetSIM; f++ {
+		if got, err := devicefamily.ParseRadio(f.String()); err != nil || got != f {
+			t.Errorf("ParseRadio(%q) = %v, %v", f.String(), got, err)
+		}
+	}
+	if _, err := devicefamily.ParseRadio("rx-only"); err == nil {
+		t.Error("ParseRadio(rx-only) succeeded")
+	}
+}
+
+func TestScanOperators(t *testing.T) {
+	tests := []struct {
+		name     string
+		new      func() *devicefamily.ATdevicefamily
+		response string
+		want     []devicefamily.Operator
+	}{
+		{"r4", sarar4.New,
+			`+COPS: (2,"Telenor","Telenor","24201",7),(1,"Telenor","Telenor","24201",9),(3,"Telia N","Telia","24202",7),,(0,1,2,3,4),(0,1,2)` + "\r\n\r\nOK",
+			[]devicefamily.Operator{
+				{Status: 2, LongName: "Telenor", ShortName: "Telenor", PLMN: "24201", AccessTechnology: 7},
+				{Status: 1, LongName: "Telenor", ShortName: "Telenor", PLMN: "24201", AccessTechnology: 9},
+				{Status: 3, LongName: "Telia N", ShortName: "Telia", PLMN: "24202", AccessTechnology: 7},
+			}},
+		// The SARA-N2 leaves out the names and the access technology
+		{"n2", saran2.New,
+			`+COPS: (2,"","","24201"),,(0-2),(2)` + "\r\n\r\nOK",
+			[]devicefamily.Operator{{Status: 2, PLMN: "24201"}}},
+		{"none found", sarar4.New, `+COPS: ,,(0,1,2,3,4),(0,1,2)` + "\r\n\r\nOK", nil},
+	}
+	for _, tt := range tests {
+		s, _ := devicefamily.NewFakeConnection(map[string]string{"AT+COPS=?": tt.response})
+		d := tt.new()
+		d.Init(s)
+		got, err := d.ScanOperators()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ScanOperators() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	s, _ := devicefamily.NewFakeConnection(map[string]string{"AT+COPS=?": "+CME ERROR: 3"})
+	d := sarar4.New()
+	d.Init(s)
+	if _, err := d.ScanOperators(); err == nil {
+		t.Error("ScanOperators() succeeded on an error")
+	}
+}
+
+func TestSetBands(t *testing.T) {
+	tests := []struct {
+		name  string
+		new   func() *devicefamily.ATdevicefamily
+		rat   devicefamily.RAT
+		bands []int
+		// cmd is empty if the bands are rejected
+		cmd string
+	}{
+		{"n2 list", saran2.New, devicefamily.RATNBIoT, []int{8, 20}, "AT+NBAND=8,20"},
+		{"n2 single", saran2.New, devicefamily.RATNBIoT, []int{20}, "AT+NBAND=20"},
+		{"r4 lte-m", sarar4.New, devicefamily.RATLTEM, []int{3, 8, 20}, "AT+UBANDMASK=0,524420"},
+		{"r4 nb-iot", sarar4.New, devicefamily.RATNBIoT, []int{20}, "AT+UBANDMASK=1,524288"},
+		{"r4 band 1", sarar4.New, devicefamily.RATLTEM, []int{1}, "AT+UBANDMASK=0,1"},
+		{"r4 band 64", sarar4.New, devicefamily.RATLTEM, []int{64}, "AT+UBANDMASK=0,9223372036854775808"},
+		{"r4 band 65", sarar4.New, devicefamily.RATLTEM, []int{65}, ""},
+		{"r4 band 0", sarar4.New, devicefamily.RATNBIoT, []int{0}, ""},
+	}
+	for _, tt := range tests {
+		s, p := devicefamily.NewFakeConnection(nil)
+		d := tt.new()
+		d.Init(s)
+		ok := d.SetBands(tt.rat, tt.bands)
+		if ok != (tt.cmd != "") {
+			t.Errorf("%s: SetBands() = %v", tt.name, ok)
+			continue
+		}
+		if tt.cmd == "" {
+			if len(p.Commands) != 0 {
+				t.Errorf("%s: sent %q for rejected bands", tt.name, p.Commands)
+			}
+			continue
+		}
+		if len(p.Commands) != 1 || p.Commands[0] != tt.cmd {
+			t.Errorf("%s: sent %q, want %q", tt.name, p.Commands, tt.cmd)
+		}
+	}
+}
+
+func TestPDPContexts(t *testing.T) {
+	tests := []struct {
+		name     string
+		new      func() *devicefamily.ATdevicefamily
+		response string
+		want     []devicefamily.PDPContext
+	}{
+		{"r4", sarar4.New,
+			"+CGDCONT: 1,\"IP\",\"telenor.iot\",\"10.0.0.5\",0,0,0,0\r\n+CGDCONT: 2,\"NONIP\",\"private.iot\",\"\",0,0,0,0\r\n\r\nOK",
+			[]devicefamily.PDPContext{
+				{CID: 1, Type: "IP", APN: "telenor.iot", Address: "10.0.0.5"},
+				{CID: 2, Type: "NONIP", APN: "private.iot"},
+			}},
+		{"n2", saran2.New,
+			"+CGDCONT: 0,\"IP\",\"telenor.iot\",,0,0,,,,,0\r\n\r\nOK",
+			[]devicefamily.PDPContext{{CID: 0, Type: "IP", APN: "telenor.iot"}}},
+		{"none", saran2.New, "OK", nil},
+	}
+	for _, tt := range tests {
+		s, _ := devicefamily.NewFakeConnection(map[string]string{"AT+CGDCONT?": tt.response})
+		d := tt.new()
+		d.Init(s)
+		got, err := d.PDPContexts()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: PDPContexts() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPDPAddress(t *testing.T) {
+	tests := []struct {
+		name      string
+		new       func() *devicefamily.ATdevicefamily
+		cid       int
+		responses map[string]string
+		want      devicefamily.PDPAddress
+		err       bool
+	}{
+		{"r4", sarar4.New, 1, map[string]string{
+			"AT+CGPADDR=1":   "+CGPADDR: 1,\"10.0.0.5\"\r\n\r\nOK",
+			"AT+CGCONTRDP=1": "+CGCONTRDP: 1,5,\"telenor.iot\",\"10.0.0.5.255.255.255.0\",\"\",\"8.8.8.8\",\"8.8.4.4\",\"\",\"\",0,0\r\n\r\nOK",
+		}, devicefamily.PDPAddress{CID: 1, IP: "10.0.0.5", DNS: []string{"8.8.8.8", "8.8.4.4"}}, false},
+		{"n2", saran2.New, 0, map[string]string{
+			"AT+CGPADDR=0":   "+CGPADDR: 0,10.0.0.5\r\n\r\nOK",
+			"AT+CGCONTRDP=0": "+CGCONTRDP: 0,5,\"telenor.iot\",\"10.0.0.5\",,\"8.8.8.8\"\r\n\r\nOK",
+		}, devicefamily.PDPAddress{CID: 0, IP: "10.0.0.5", DNS: []string{"8.8.8.8"}}, false},
+		{"no dns", sarar4.New, 1, map[string]string{
+			"AT+CGPADDR=1": "+CGPADDR: 1,\"10.0.0.5\"\r\n\r\nOK",
+		}, devicefamily.PDPAddress{CID: 1, IP: "10.0.0.5"}, false},
+		{"not active", sarar4.New, 1, map[string]string{
+			"AT+CGPADDR=1": "+CGPADDR: 1\r\n\r\nOK",
+		}, devicefamily.PDPAddress{}, true},
+		{"dns error", sarar4.New, 1, map[string]string{
+			"AT+CGPADDR=1":   "+CGPADDR: 1,\"10.0.0.5\"\r\n\r\nOK",
+			"AT+CGCONTRDP=1": "ERROR",
+		}, devicefamily.PDPAddress{}, true},
+	}
+	for _, tt := range tests {
+		s, _ := devicefamily.NewFakeConnection(tt.responses)
+		d := tt.new()
+		d.Init(s)
+		got, err := d.PDPAddress(tt.cid)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v", tt.name, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: PDPAddress() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,35 +1,200 @@
 package devicefamily
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/ExploratoryEngineering/labdevicetester/pkg/serial"
 )
 
 type RadioFunctionality int
 
 const (
+	// RadioOff is minimum functionality, RF off but the SIM still accessible
 	RadioOff RadioFunctionality = iota
 	RadioFull
+	// RadioAirplane disables both transmit and receive RF circuits
+	RadioAirplane
+	// RadioSIMOff is minimum functionality with the SIM deactivated
+	RadioSIMOff
+	// RadioSilentReset resets the module without resetting the SIM
+	RadioSilentReset
+	// RadioSilentResetSIM resets both the module and the SIM
+	RadioSilentResetSIM
 )
 
+func (f RadioFunctionality) String() string {
+	switch f {
+	case RadioOff:
+		return "off"
+	case RadioFull:
+		return "full"
+	case RadioAirplane:
+		return "airplane"
+	case RadioSIMOff:
+		return "sim-off"
+	case RadioSilentReset:
+		return "silent-reset"
+	case RadioSilentResetSIM:
+		return "silent-reset-sim"
+	}
+	return "unknown"
+}
+
+// ParseRadio returns the radio functionality with the given name as returned
+// by String
+func ParseRadio(name string) (RadioFunctionality, error) {
+	for f := RadioOff; f <= RadioSilentResetSIM; f++ {
+		if f.String() == name {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown radio functionality %q", name)
+}
+
 type Interface interface {
 	BaudRate() int
 	Init(*serial.SerialConnection)
-	FirmwareVersion()
+	FirmwareVersion() (string, error)
 	IMEI() (int, error)
 	IMSI() (int, error)
 	RebootModule() bool
+	WaitForBoot() (Boot, error)
+	Resets() []Reset
+	DetectsResets() bool
 	SetAPN(apn string) bool
+	DefaultContextID() int
+	PDPContexts() ([]PDPContext, error)
+	DefinePDPContext(PDPContext) bool
+	SetPDPAuth(cid int, auth PDPAuth) bool
+	ActivatePDPContext(cid int) bool
+	DeactivatePDPContext(cid int) bool
+	PDPAddress(cid int) (PDPAddress, error)
 	SetRadio(RadioFunctionality) bool
 	PowerSaveMode(enabled, tau, activeTime uint8) bool
 	AutoOperatorSelection() bool
+	ManualOperatorSelection(plmn string) bool
+	ScanOperators() ([]Operator, error)
+	SetRAT(RAT) bool
+	SetBands(rat RAT, bands []int) bool
 	RegistrationStatus() (int, error)
+	// DisableEDRX and SetEDRX configure eDRX for the RAT in use. SetEDRX
+	// enables it with the encoded cycle length, e.g. 0b0101 for 81.92
+	// seconds.
 	DisableEDRX() bool
+	SetEDRX(cycle uint8) bool
+	EnableNITZ() bool
+	NetworkTime() (NetworkTime, error)
+	LastNITZ() (NetworkTime, bool)
+	ResolveHostname(hostname string) (string, error)
+	ConfigureGPIO(pin int) bool
+	SetGPIO(pin int, high bool) bool
+	SupportsProtocol(protocol string) bool
 	CreateSocket(protocol string, listenPort int) (int, error)
 	CloseSocket(socket int) bool
-	SendUDP(socket int, ip string, port int, flag SendFlag, data []byte) bool
+	SendUDP(socket int, host string, port int, flag SendFlag, data []byte) bool
+	ConnectSocket(socket int, host string, port int) bool
+	SendTCP(socket int, data []byte) bool
 	ReceiveUDP(socket, expectedBytes int) ([]byte, error)
 }
 
+// RAT is a radio access technology
+type RAT int
+
+const (
+	RATLTEM RAT = iota
+	RATNBIoT
+)
+
+func (r RAT) String() string {
+	switch r {
+	case RATLTEM:
+		return "lte-m"
+	case RATNBIoT:
+		return "nb-iot"
+	}
+	return "unknown"
+}
+
+// ParseRAT returns the RAT with the given name as returned by String
+func ParseRAT(name string) (RAT, error) {
+	for _, r := range []RAT{RATLTEM, RATNBIoT} {
+		if r.String() == name {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown RAT %q", name)
+}
+
+// Operator is a network operator as reported by an operator scan
+type Operator struct {
+	// Status is 0 for unknown, 1 for available, 2 for current and 3 for forbidden
+	Status    int
+	LongName  string
+	ShortName string
+	PLMN      string
+	// AccessTechnology is the 3GPP <AcT> value, e.g. 7 for LTE-M and 9 for NB-IoT
+	AccessTechnology int
+}
+
+// PDPContext is a packet data protocol context definition
+type PDPContext struct {
+	CID int
+	// Type is the PDP type, e.g. "IP", "IPV6" or "NONIP"
+	Type    string
+	APN     string
+	Address string
+}
+
+type AuthProtocol int
+
+const (
+	AuthNone AuthProtocol = iota
+	AuthPAP
+	AuthCHAP
+)
+
+// PDPAuth is the authentication used when activating a PDP context on a
+// private APN
+type PDPAuth struct {
+	Protocol AuthProtocol
+	Username string
+	Password string
+}
+
+// PDPAddress holds the addresses assigned by the network to an active PDP
+// context
+type PDPAddress struct {
+	CID int
+	IP  string
+	DNS []string
+}
+
+// NetworkTime is a time reported by the module, either its network
+// synchronised clock or a NITZ update from the network
+type NetworkTime struct {
+	Time time.Time
+	// Offset is the module time minus the host time when it was read
+	Offset time.Duration
+	// Source is the AT command or URC that reported the time
+	Source string
+}
+
+// Boot holds the host times of the boot milestones after power on
+type Boot struct {
+	// URC is when the boot URC was received, zero if the device has none
+	URC time.Time
+	// FirstAT is when the device first responded to AT
+	FirstAT time.Time
+}
+
+// Reset is a boot URC seen on the serial line, either after a reboot or
+// because the module reset by itself, e.g. on brown-out
+type Reset struct {
+	Time time.Time `json:"time"`
+	Line string    `json:"line"`
+}
+
 type SendFlag int
 
 const (
@@ -8,20 +8,45 @@ func New() *devicefamily.ATdevicefamily {
 	spec := devicefamily.ATDeviceSpec{
 		BaudRate:        9600,
 		Reboot:          `AT+NRB`,
+		BootURC:         `REBOOT_CAUSE`,
 		FirmwareVersion: `ATI9`,
 		Radio:           `AT+CFUN=%v`,
+		RadioModes: map[devicefamily.RadioFunctionality]string{
+			devicefamily.RadioOff:  "0",
+			devicefamily.RadioFull: "1",
+		},
 		// DisableAutoConnect: `AT+NCONFIG="AUTOCONNECT","FALSE"`,
 		// EnableAutoConnect:  `AT+NCONFIG="AUTOCONNECT","TRUE"`,
 		ConfigAPN:                 `AT+CGDCONT=0,"IP","%s";+CGATT=1`,
+		ContextID:                 0,
+		ListPDPContexts:           `AT+CGDCONT?`,
+		DefinePDPContext:          `AT+CGDCONT=%d,"%s","%s"`,
+		ActivatePDPContext:        `AT+CGACT=%d,%d`,
+		PDPAddress:                `AT+CGPADDR=%d`,
+		PDPDynamicParameters:      `AT+CGCONTRDP=%d`,
 		AutoOperatorSelection:     `AT+COPS=0`,
+		ManualOperatorSelection:   `AT+COPS=1,2,"%s"`,
+		OperatorScan:              `AT+COPS=?`,
+		Bands:                     `AT+NBAND=%s`,
 		RegistrationStatus:        `AT+CEREG?`,
 		PSM:                       `AT+CPSMS=%d,,,"%08b","%08b"`,
-		DisableEDRX:               `AT+CEDRXS=0,5`,
+		DisableEDRX:               `AT+CEDRXS=0,%s`,
+		EDRX:                      `AT+CEDRXS=2,%s,"%04b"`,
+		Clock:                     `AT+CCLK?`,
+		TimeZoneReporting:         `AT+CTZR=3`,
+		TimeZoneURC:               `+CTZEU`,
 		CreateUDPSocket:           `AT+NSOCR="DGRAM",17,%d,1`,
 		CloseSocket:               `AT+NSOCL=%d`,
 		SendUDP:                   `AT+NSOSTF=%[1]d,"%[2]v",%[3]d,0x%03[4]x,%[5]d,"%[6]X"`,
 		ReceiveUDP:                `AT+NSORF=%d,%d`,
 		ReceivedMessageIndication: `+NSONMI`,
+		RATs: map[devicefamily.RAT]string{
+			devicefamily.RATNBIoT: "",
+		},
+		RebootRAT: devicefamily.RATNBIoT,
+		EDRXRATs: map[devicefamily.RAT]string{
+			devicefamily.RATNBIoT: "5",
+		},
 	}
 	return devicefamily.New(spec)
 }
@@ -6,20 +6,63 @@ import (
 
 func New() *devicefamily.ATdevicefamily {
 	spec := devicefamily.ATDeviceSpec{
-		BaudRate:              115200,
-		Reboot:                `AT+COPS=2;+URAT=8;+CFUN=15`,
-		FirmwareVersion:       `ATI9`,
-		ConfigAPN:             `AT+CGDCONT=1,"IP","%s";+CGATT=1`,
-		Radio:                 `ATE0;+CFUN=%v`,
-		AutoOperatorSelection: `AT+COPS=0`,
-		RegistrationStatus:    `AT+CEREG?`,
-		PSM:                   `AT+CPSMS=%d,,,"%08b","%08b"`,
-		DisableEDRX:           `AT+CEDRXS=0,5`,
-		CreateUDPSocket:       `AT+USOCR=17,%d`,
-		CreateTCPSocket:       `AT+USOCR=6,%d`,
-		CloseSocket:           `AT+USOCL=%d`,
-		SendUDP:               `AT+USOST=%[1]d,"%[2]v",%[3]d,%[5]d,"%[6]s"`,
-		ReceiveUDP:            `AT+USORF=%d,%d`,
+		BaudRate:        115200,
+		Reboot:          `AT+COPS=2;+URAT=8;+CFUN=15`,
+		FirmwareVersion: `ATI9`,
+		ConfigAPN:       `AT+CGDCONT=1,"IP","%s";+CGATT=1`,
+		ContextID:       1,
+		Radio:           `ATE0;+CFUN=%v`,
+		RadioModes: map[devicefamily.RadioFunctionality]string{
+			devicefamily.RadioOff:            "0",
+			devicefamily.RadioFull:           "1",
+			devicefamily.RadioAirplane:       "4",
+			devicefamily.RadioSilentReset:    "15",
+			devicefamily.RadioSilentResetSIM: "16",
+			devicefamily.RadioSIMOff:         "19",
+		},
+		ListPDPContexts:         `AT+CGDCONT?`,
+		DefinePDPContext:        `AT+CGDCONT=%d,"%s","%s"`,
+		ActivatePDPContext:      `AT+CGACT=%d,%d`,
+		PDPAddress:              `AT+CGPADDR=%d`,
+		PDPDynamicParameters:    `AT+CGCONTRDP=%d`,
+		PDPAuth:                 `AT+UAUTHREQ=%d,%d,"%s","%s"`,
+		AutoOperatorSelection:   `AT+COPS=0`,
+		ManualOperatorSelection: `AT+COPS=1,2,"%s"`,
+		OperatorScan:            `AT+COPS=?`,
+		SelectRAT:               `AT+URAT=%v`,
+		BandMask:                `AT+UBANDMASK=%v,%d`,
+		RegistrationStatus:      `AT+CEREG?`,
+		PSM:                     `AT+CPSMS=%d,,,"%08b","%08b"`,
+		DisableEDRX:             `AT+CEDRXS=0,%s`,
+		EDRX:                    `AT+CEDRXS=2,%s,"%04b"`,
+		ResolveHostname:         `AT+UDNSRN=0,"%s"`,
+		GPIOConfig:              `AT+UGPIOC=%d,0,0`,
+		GPIOWrite:               `AT+UGPIOW=%d,%d`,
+		Clock:                   `AT+CCLK?`,
+		TimeZoneReporting:       `AT+CTZR=2`,
+		TimeZoneURC:             `+CTZE`,
+		CreateUDPSocket:         `AT+USOCR=17,%d`,
+		CreateTCPSocket:         `AT+USOCR=6,%d`,
+		CloseSocket:             `AT+USOCL=%d`,
+		SendUDP:                 `AT+USOST=%[1]d,"%[2]v",%[3]d,%[5]d,"%[6]s"`,
+		ConnectSocket:           `AT+USOCO=%d,"%s",%d`,
+		SendTCP:                 `AT+USOWR=%d,%d,"%s"`,
+		ReceiveUDP:              `AT+USORF=%d,%d`,
+		RATs: map[devicefamily.RAT]string{
+			devicefamily.RATLTEM:  "7",
+			devicefamily.RATNBIoT: "8",
+		},
+		// Reboot selects NB-IoT
+		RebootRAT: devicefamily.RATNBIoT,
+		// The AcT of +CEDRXS is 4 for E-UTRAN (LTE-M) and 5 for NB-S1
+		EDRXRATs: map[devicefamily.RAT]string{
+			devicefamily.RATLTEM:  "4",
+			devicefamily.RATNBIoT: "5",
+		},
+		BandMaskRATs: map[devicefamily.RAT]string{
+			devicefamily.RATLTEM:  "0",
+			devicefamily.RATNBIoT: "1",
+		},
 	}
 	return devicefamily.New(spec)
 }
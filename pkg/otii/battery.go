@@ -0,0 +1,168 @@
+package otii
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/scenario"
+)
+
+// BatteryProfile emulates a discharging battery by stepping the main voltage
+// while recording
+type BatteryProfile struct {
+	Points []VoltagePoint `json:"points"`
+}
+
+// VoltagePoint sets the main voltage at a time from the recording start. The
+// voltage is kept until the next point.
+type VoltagePoint struct {
+	At      scenario.Duration `json:"at"`
+	Voltage float64           `json:"voltage"`
+}
+
+// LinearDischarge steps the voltage linearly from from to to over duration
+func LinearDischarge(from, to float64, duration time.Duration, steps int) BatteryProfile {
+	if steps < 1 {
+		steps = 1
+	}
+	var p BatteryProfile
+	for i := 0; i <= steps; i++ {
+		p.Points = append(p.Points, VoltagePoint{
+			At:      scenario.Duration{Duration: duration * time.Duration(i) / time.Duration(steps)},
+			Voltage: from + (to-from)*float64(i)/float64(steps),
+		})
+	}
+	return p
+}
+
+// ParseBatteryProfile parses either a linear discharge on the form
+// from:to:duration[:steps], e.g. 3.6:3.0:60s:12, or the name of a CSV file
+// with seconds and voltage columns describing the curve
+func ParseBatteryProfile(spec string) (BatteryProfile, error) {
+	if strings.HasSuffix(spec, ".csv") {
+		f, err := os.Open(spec)
+		if err != nil {
+			return BatteryProfile{}, err
+		}
+		defer f.Close()
+		return readBatteryCSV(f)
+	}
+
+	parts := strings.Split(spec, ":")
+	if len(parts) < 3 || len(parts) > 4 {
+		return BatteryProfile{}, fmt.Errorf("invalid battery profile %q, expected from:to:duration[:steps]", spec)
+	}
+	from, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return BatteryProfile{}, err
+	}
+	to, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return BatteryProfile{}, err
+	}
+	duration, err := time.ParseDuration(parts[2])
+	if err != nil {
+		return BatteryProfile{}, err
+	}
+	steps := 10
+	if len(parts) == 4 {
+		if steps, err = strconv.Atoi(parts[3]); err != nil {
+			return BatteryProfile{}, err
+		}
+	}
+	p := LinearDischarge(from, to, duration, steps)
+	return p, p.validate()
+}
+
+func readBatteryCSV(r io.Reader) (BatteryProfile, error) {
+	var p BatteryProfile
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return p, err
+	}
+	for i, rec := range records {
+		if len(rec) != 2 {
+			return p, fmt.Errorf("line %d: expected seconds and voltage", i+1)
+		}
+		seconds, err := strconv.ParseFloat(strings.TrimSpace(rec[0]), 64)
+		if err != nil {
+			if i == 0 {
+				// Header
+				continue
+			}
+			return p, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		voltage, err := strconv.ParseFloat(strings.TrimSpace(rec[1]), 64)
+		if err != nil {
+			return p, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		p.Points = append(p.Points, VoltagePoint{At: scenario.Duration{Duration: time.Duration(seconds * float64(time.Second))}, Voltage: voltage})
+	}
+	return p, p.validate()
+}
+
+func (p BatteryProfile) validate() error {
+	if len(p.Points) == 0 {
+		return errors.New("battery profile has no points")
+	}
+	for i, pt := range p.Points {
+		if pt.Voltage < 0.5 || pt.Voltage > 4.2 {
+			return fmt.Errorf("battery voltage %g V out of range 0.5-4.2 V", pt.Voltage)
+		}
+		if i > 0 && pt.At.Duration < p.Points[i-1].At.Duration {
+			return errors.New("battery profile points must be in order")
+		}
+	}
+	return nil
+}
+
+// voltageStep is a voltage held for a while
+type voltageStep struct {
+	voltage float64
+	hold    time.Duration
+}
+
+// steps returns the voltage steps of the profile within a recording of
+// duration
+func (p BatteryProfile) steps(duration time.Duration) []voltageStep {
+	var steps []voltageStep
+	for i, pt := range p.Points {
+		if pt.At.Duration >= duration {
+			break
+		}
+		end := duration
+		if i+1 < len(p.Points) && p.Points[i+1].At.Duration < duration {
+			end = p.Points[i+1].At.Duration
+		}
+		steps = append(steps, voltageStep{voltage: pt.Voltage, hold: end - pt.At.Duration})
+	}
+	return steps
+}
+
+// start is how long the main voltage is kept before the first point
+func (p BatteryProfile) start(duration time.Duration) time.Duration {
+	if len(p.Points) == 0 || p.Points[0].At.Duration > duration {
+		return duration
+	}
+	return p.Points[0].At.Duration
+}
+
+// script returns the Lua statements stepping the voltage during a recording
+// of duration, see waitScript
+func (p BatteryProfile) script(box string, duration time.Duration) string {
+	var b strings.Builder
+	if start := p.start(duration); start > 0 {
+		fmt.Fprintf(&b, "wait(%d)\n", start/time.Millisecond)
+	}
+	for _, step := range p.steps(duration) {
+		fmt.Fprintf(&b, "if not stopped then %s:set_main_voltage(%g) end\n", box, step.voltage)
+		fmt.Fprintf(&b, "wait(%d)\n", step.hold/time.Millisecond)
+	}
+	return b.String()
+}
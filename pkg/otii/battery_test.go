@@ -0,0 +1,133 @@
+package otii
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/scenario"
+)
+
+func TestParseBatteryProfile(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []VoltagePoint
+	}{
+		{"3.6:3.0:30s:3", []VoltagePoint{point(0, 3.6), point(10*time.Second, 3.4), point(20*time.Second, 3.2), point(30*time.Second, 3.0)}},
+		{"3.3:3.3:1m:1", []VoltagePoint{point(0, 3.3), point(time.Minute, 3.3)}},
+	}
+	for _, tt := range tests {
+		p, err := ParseBatteryProfile(tt.spec)
+		if err != nil {
+			t.Errorf("ParseBatteryProfile(%q): %v", tt.spec, err)
+			continue
+		}
+		if len(p.Points) != len(tt.want) {
+			t.Errorf("ParseBatteryProfile(%q) = %v, want %v", tt.spec, p.Points, tt.want)
+			continue
+		}
+		for i, pt := range p.Points {
+			if pt.At != tt.want[i].At || !near(pt.Voltage, tt.want[i].Voltage) {
+				t.Errorf("ParseBatteryProfile(%q) = %v, want %v", tt.spec, p.Points, tt.want)
+				break
+			}
+		}
+	}
+
+	if p, err := ParseBatteryProfile("3.6:3.0:60s"); err != nil || len(p.Points) != 11 {
+		t.Errorf("default steps: %v, %v, want 11 points", p.Points, err)
+	}
+}
+
+func TestParseBatteryProfileInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"3.6:3.0",
+		"3.6:3.0:30s:3:1",
+		"x:3.0:30s",
+		"3.6:3.0:30",
+		"3.6:3.0:30s:x",
+		"5.0:3.0:30s",
+		"3.6:0.1:30s",
+		"missing.csv",
+	} {
+		if _, err := ParseBatteryProfile(spec); err == nil {
+			t.Errorf("ParseBatteryProfile(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestBatteryCSV(t *testing.T) {
+	tests := []struct {
+		csv  string
+		want []VoltagePoint
+		ok   bool
+	}{
+		{"seconds,volts\n0,3.6\n10.5,3.4\n20,3.1\n", []VoltagePoint{point(0, 3.6), point(10500*time.Millisecond, 3.4), point(20*time.Second, 3.1)}, true},
+		{"0, 3.6\n5, 3.5\n", []VoltagePoint{point(0, 3.6), point(5*time.Second, 3.5)}, true},
+		{"seconds,volts\n", nil, false},
+		{"0,3.6\nx,3.5\n", nil, false},
+		{"0,3.6\n5\n", nil, false},
+		{"10,3.6\n5,3.5\n", nil, false},
+	}
+	dir, err := ioutil.TempDir("", "battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for i, tt := range tests {
+		filename := filepath.Join(dir, strings.Repeat("x", i+1)+".csv")
+		if err := ioutil.WriteFile(filename, []byte(tt.csv), 0644); err != nil {
+			t.Fatal(err)
+		}
+		p, err := ParseBatteryProfile(filename)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: error %v", tt.csv, err)
+			continue
+		}
+		if tt.ok && !reflect.DeepEqual(p.Points, tt.want) {
+			t.Errorf("%q = %v, want %v", tt.csv, p.Points, tt.want)
+		}
+	}
+}
+
+func TestBatteryScript(t *testing.T) {
+	p := BatteryProfile{Points: []VoltagePoint{point(time.Second, 3.6), point(3*time.Second, 3.3), point(10*time.Second, 3.0)}}
+	want := "wait(1000)\n" +
+		"if not stopped then box:set_main_voltage(3.6) end\n" +
+		"wait(2000)\n" +
+		"if not stopped then box:set_main_voltage(3.3) end\n" +
+		"wait(2000)\n"
+	if got := p.script("box", 5*time.Second); got != want {
+		t.Errorf("script() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func point(at time.Duration, voltage float64) VoltagePoint {
+	return VoltagePoint{At: scenario.Duration{Duration: at}, Voltage: voltage}
+}
+
+func near(a, b float64) bool {
+	d := a - b
+	return d > -1e-9 && d < 1e-9
+}
+
+func TestBatteryProfileJSON(t *testing.T) {
+	p := BatteryProfile{Points: []VoltagePoint{point(0, 3.6), point(1500*time.Millisecond, 3.3)}}
+	buf, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"points":[{"at":"0s","voltage":3.6},{"at":"1.5s","voltage":3.3}]}`; string(buf) != want {
+		t.Errorf("JSON %s, want %s", buf, want)
+	}
+	var decoded BatteryProfile
+	if err := json.Unmarshal(buf, &decoded); err != nil || !reflect.DeepEqual(decoded, p) {
+		t.Errorf("decoded %v, %v, want %v", decoded, err, p)
+	}
+}
@@ -0,0 +1,252 @@
+package capture
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Channel kinds as used in the data source ids of an Arc
+const (
+	MainCurrent = "maincurrent"
+	MainVoltage = "mainvolt"
+	MainEnergy  = "mainenergy"
+	// GPI1 and GPI2 are the digital inputs, recorded as 0 or 1 samples
+	GPI1 = "gpi1"
+	GPI2 = "gpi2"
+)
+
+// Capture is a recording saved by Otii
+type Capture struct {
+	FileFormat      string
+	SoftwareVersion string
+	Saved           time.Time
+	Recordings      []Recording
+	Series          []*Series
+}
+
+// Recording is one recording in a capture
+type Recording struct {
+	ID    int
+	Name  string
+	Start time.Time
+}
+
+// Series is the samples of one channel in one recording
+type Series struct {
+	// ID is the data source id, the device id followed by the kind, e.g.
+	// Arc5120...maincurrentdatasource
+	ID       string
+	Name     string
+	Unit     string
+	DeviceID string
+	// Recording is the id of the recording the samples belong to
+	Recording int
+	Start     time.Time
+	Interval  time.Duration
+	Values    []float64
+}
+
+// Open reads a .otii capture file
+func Open(filename string) (*Capture, error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	files := make(map[string]*zip.File)
+	for _, f := range r.File {
+		files[f.Name] = f
+	}
+
+	meta, ok := files["_otii.json"]
+	if !ok {
+		return nil, errors.New("capture: _otii.json not found")
+	}
+	var doc document
+	if err := readJSON(meta, &doc); err != nil {
+		return nil, fmt.Errorf("capture: invalid _otii.json: %v", err)
+	}
+
+	c := &Capture{
+		FileFormat:      doc.DocumentInfo.FileFormat,
+		SoftwareVersion: doc.DocumentInfo.SoftwareVersion,
+		Saved:           millis(doc.DocumentInfo.Timestamp),
+	}
+	starts := make(map[int]time.Time)
+	for _, rec := range doc.Project.DataStorage.Recordings {
+		start := millis(rec.StartTime + rec.Offset)
+		starts[rec.ID] = start
+		c.Recordings = append(c.Recordings, Recording{ID: rec.ID, Name: rec.Name, Start: start})
+	}
+
+	for _, source := range doc.Project.DataStorage.Sources {
+		for _, storage := range source.SampleStorages {
+			f, ok := files[storage.DataFiles]
+			if !ok {
+				return nil, fmt.Errorf("capture: data file %s not found", storage.DataFiles)
+			}
+			values, err := readSamples(f, storage.Samples)
+			if err != nil {
+				return nil, fmt.Errorf("capture: %s: %v", storage.DataFiles, err)
+			}
+			// Intervals and offsets are in microseconds
+			c.Series = append(c.Series, &Series{
+				ID:        source.ID,
+				Name:      source.Name,
+				Unit:      source.Unit,
+				DeviceID:  source.ProviderID,
+				Recording: storage.RecordingID,
+				Start:     starts[storage.RecordingID].Add(time.Duration(storage.Offset) * time.Microsecond),
+				Interval:  time.Duration(storage.SamplingInterval) * time.Microsecond,
+				Values:    values,
+			})
+		}
+	}
+	return c, nil
+}
+
+// Find returns the first series of the given kind, e.g. MainCurrent, or nil if
+// the channel wasn't recorded
+func (c *Capture) Find(kind string) *Series {
+	for _, s := range c.Series {
+		if strings.HasSuffix(s.ID, kind+"datasource") {
+			return s
+		}
+	}
+	return nil
+}
+
+// Len returns the number of samples
+func (s *Series) Len() int {
+	return len(s.Values)
+}
+
+// Time returns the time of sample i
+func (s *Series) Time(i int) time.Time {
+	return s.Start.Add(time.Duration(i) * s.Interval)
+}
+
+// End returns the time after the last sample
+func (s *Series) End() time.Time {
+	return s.Time(s.Len())
+}
+
+// Duration returns the duration covered by the samples
+func (s *Series) Duration() time.Duration {
+	return time.Duration(s.Len()) * s.Interval
+}
+
+// Index returns the index of the sample at t, clamped to the series
+func (s *Series) Index(t time.Time) int {
+	if s.Interval <= 0 {
+		return 0
+	}
+	i := int(t.Sub(s.Start) / s.Interval)
+	if i < 0 {
+		return 0
+	}
+	if i > s.Len() {
+		return s.Len()
+	}
+	return i
+}
+
+// Slice returns the samples from from up to to. The values are shared with s.
+func (s *Series) Slice(from, to time.Time) *Series {
+	i, j := s.Index(from), s.Index(to)
+	if j < i {
+		j = i
+	}
+	slice := *s
+	slice.Start = s.Time(i)
+	slice.Values = s.Values[i:j]
+	return &slice
+}
+
+type document struct {
+	DocumentInfo struct {
+		FileFormat      string `json:"fileformat"`
+		SoftwareVersion string `json:"softwareversion"`
+		Timestamp       int64  `json:"timestamp"`
+	} `json:"documentinfo"`
+	Project struct {
+		DataStorage struct {
+			Sources []struct {
+				ID             string `json:"id"`
+				Name           string `json:"name"`
+				ProviderID     string `json:"provider-id"`
+				Unit           string `json:"unit"`
+				SampleStorages []struct {
+					DataFiles        string `json:"data_files"`
+					Samples          int    `json:"nbr_of_samples"`
+					Offset           int64  `json:"offset"`
+					RecordingID      int    `json:"recording-id"`
+					SamplingInterval int64  `json:"sampling-interval"`
+				} `json:"sample-storages"`
+			} `json:"data-source-storages"`
+			Recordings []struct {
+				ID        int    `json:"id"`
+				Name      string `json:"name"`
+				Offset    int64  `json:"offset"`
+				StartTime int64  `json:"start-time"`
+			} `json:"recordings"`
+		} `json:"data-storage"`
+	} `json:"project"`
+}
+
+func millis(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+func readJSON(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return json.NewDecoder(rc).Decode(v)
+}
+
+// readSamples reads a data file, a big endian uint32 format version followed
+// by big endian float64 samples
+func readSamples(f *zip.File, count int) ([]float64, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	r := bufio.NewReader(rc)
+
+	var version uint32
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, err
+	}
+	if version != 1 {
+		return nil, fmt.Errorf("unsupported data file version %d", version)
+	}
+
+	values := make([]float64, 0, count)
+	var buf [8]byte
+	for {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		values = append(values, math.Float64frombits(binary.BigEndian.Uint64(buf[:])))
+	}
+	if len(values) != count {
+		return nil, fmt.Errorf("expected %d samples, found %d", count, len(values))
+	}
+	return values, nil
+}
@@ -0,0 +1,110 @@
+package capture
+
+import (
+	"testing"
+	"time"
+)
+
+// The fixtures are the captures checked in with the repository
+const (
+	sendCapture        = "../../../captures/capture_n2_send_2019-03-29T14:51:17.otii"
+	sendReceiveCapture = "../../../captures/capture_n2_sendreceive_2019-03-29T14:45:29.otii"
+	arcID              = "Arc51203120393830503230323133323033"
+)
+
+func openFixture(t *testing.T, filename string) *Capture {
+	t.Helper()
+	c, err := Open(filename)
+	if err != nil {
+		t.Fatalf("Open(%s): %v", filename, err)
+	}
+	return c
+}
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		filename string
+		start    time.Time
+		samples  map[string]int
+	}{
+		{sendCapture, time.Unix(0, 1553867447559*int64(time.Millisecond)), map[string]int{
+			MainCurrent: 119985, MainVoltage: 29997, MainEnergy: 119985,
+		}},
+		{sendReceiveCapture, time.Unix(0, 1553867099271*int64(time.Millisecond)), map[string]int{
+			MainCurrent: 120001, MainVoltage: 30001, MainEnergy: 120001,
+		}},
+	}
+	intervals := map[string]time.Duration{
+		MainCurrent: 250 * time.Microsecond,
+		MainVoltage: time.Millisecond,
+		MainEnergy:  250 * time.Microsecond,
+	}
+	for _, tt := range tests {
+		c := openFixture(t, tt.filename)
+		if c.FileFormat != "0.24" || c.SoftwareVersion != "2.5.1" {
+			t.Errorf("%s: format %s version %s, want 0.24 and 2.5.1", tt.filename, c.FileFormat, c.SoftwareVersion)
+		}
+		if len(c.Recordings) != 1 || !c.Recordings[0].Start.Equal(tt.start) {
+			t.Errorf("%s: recordings %v, want one starting at %v", tt.filename, c.Recordings, tt.start)
+		}
+		if len(c.Series) != len(tt.samples) {
+			t.Errorf("%s: %d series, want %d", tt.filename, len(c.Series), len(tt.samples))
+		}
+		for kind, n := range tt.samples {
+			s := c.Find(kind)
+			if s == nil {
+				t.Errorf("%s: %s not found", tt.filename, kind)
+				continue
+			}
+			if s.Len() != n || s.Interval != intervals[kind] || !s.Start.Equal(tt.start) || s.DeviceID != arcID {
+				t.Errorf("%s: %s has %d samples every %v from %v on %s, want %d every %v from %v on %s",
+					tt.filename, kind, s.Len(), s.Interval, s.Start, s.DeviceID, n, intervals[kind], tt.start, arcID)
+			}
+		}
+		if c.Find(GPI1) != nil {
+			t.Errorf("%s: found %s, which wasn't recorded", tt.filename, GPI1)
+		}
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	for _, filename := range []string{"capture_test.go", "missing.otii"} {
+		if _, err := Open(filename); err == nil {
+			t.Errorf("Open(%s) succeeded", filename)
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	start := time.Unix(100, 0)
+	s := &Series{Start: start, Interval: time.Second, Values: []float64{0, 1, 2, 3, 4}}
+	tests := []struct {
+		from, to time.Duration
+		want     []float64
+	}{
+		{0, 5 * time.Second, []float64{0, 1, 2, 3, 4}},
+		{time.Second, 3 * time.Second, []float64{1, 2}},
+		{-time.Second, time.Second, []float64{0}},
+		{4 * time.Second, 10 * time.Second, []float64{4}},
+		{3 * time.Second, time.Second, []float64{}},
+	}
+	for _, tt := range tests {
+		got := s.Slice(start.Add(tt.from), start.Add(tt.to))
+		if len(got.Values) != len(tt.want) {
+			t.Errorf("Slice(%v, %v) = %v, want %v", tt.from, tt.to, got.Values, tt.want)
+			continue
+		}
+		for i := range tt.want {
+			if got.Values[i] != tt.want[i] {
+				t.Errorf("Slice(%v, %v) = %v, want %v", tt.from, tt.to, got.Values, tt.want)
+				break
+			}
+		}
+		if len(tt.want) > 0 && !got.Start.Equal(start.Add(time.Duration(tt.want[0])*time.Second)) {
+			t.Errorf("Slice(%v, %v) starts at %v", tt.from, tt.to, got.Start)
+		}
+	}
+	if s.End() != start.Add(5*time.Second) || s.Duration() != 5*time.Second {
+		t.Errorf("End() = %v, Duration() = %v", s.End(), s.Duration())
+	}
+}
@@ -0,0 +1,34 @@
+package capture
+
+import "time"
+
+// Edge is a level change on a digital input
+type Edge struct {
+	Time   time.Time `json:"time"`
+	Rising bool      `json:"rising"`
+}
+
+// Edges returns the level changes of a digital input series. Samples above
+// 0.5 are high.
+func (s *Series) Edges() []Edge {
+	var edges []Edge
+	for i := 1; i < s.Len(); i++ {
+		prev, cur := s.Values[i-1] > 0.5, s.Values[i] > 0.5
+		if prev != cur {
+			edges = append(edges, Edge{Time: s.Time(i), Rising: cur})
+		}
+	}
+	return edges
+}
+
+// RisingEdges returns the times of the rising edges of a digital input
+// series, e.g. sync pulses
+func (s *Series) RisingEdges() []time.Time {
+	var times []time.Time
+	for _, e := range s.Edges() {
+		if e.Rising {
+			times = append(times, e.Time)
+		}
+	}
+	return times
+}
@@ -0,0 +1,29 @@
+package capture
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEdges(t *testing.T) {
+	start := time.Unix(0, 0)
+	s := &Series{Start: start, Interval: time.Millisecond, Values: []float64{0, 1, 1, 0, 0, 1, 0}}
+	want := []Edge{
+		{start.Add(1 * time.Millisecond), true},
+		{start.Add(3 * time.Millisecond), false},
+		{start.Add(5 * time.Millisecond), true},
+		{start.Add(6 * time.Millisecond), false},
+	}
+	edges := s.Edges()
+	if len(edges) != len(want) {
+		t.Fatalf("Edges() = %v, want %v", edges, want)
+	}
+	for i := range want {
+		if !edges[i].Time.Equal(want[i].Time) || edges[i].Rising != want[i].Rising {
+			t.Errorf("edge %d = %v, want %v", i, edges[i], want[i])
+		}
+	}
+	if rising := s.RisingEdges(); len(rising) != 2 || !rising[1].Equal(want[2].Time) {
+		t.Errorf("RisingEdges() = %v", rising)
+	}
+}
@@ -0,0 +1,162 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// Metrics are power statistics over a window of a capture
+type Metrics struct {
+	// Duration is in seconds
+	Duration float64 `json:"duration_s"`
+	// Energy is in joules
+	Energy float64 `json:"energy_j"`
+	// Currents are in amperes
+	AverageCurrent float64 `json:"average_current_a"`
+	PeakCurrent    float64 `json:"peak_current_a"`
+	MinCurrent     float64 `json:"min_current_a"`
+	// Charge is in milliampere hours
+	Charge float64 `json:"charge_mah"`
+	// TimeAboveThreshold is the time in seconds the current was above
+	// Threshold
+	Threshold          float64      `json:"threshold_a"`
+	TimeAboveThreshold float64      `json:"time_above_threshold_s"`
+	Percentiles        []Percentile `json:"percentiles"`
+}
+
+// Percentile is a current percentile, e.g. the 99th percentile current
+type Percentile struct {
+	Percentile float64 `json:"percentile"`
+	Current    float64 `json:"current_a"`
+}
+
+// DefaultPercentiles are the percentiles computed by Metrics when none are
+// given
+var DefaultPercentiles = []float64{50, 90, 99}
+
+// Metrics computes the metrics over the whole capture
+func (c *Capture) Metrics(threshold float64, percentiles ...float64) (Metrics, error) {
+	return c.MetricsBetween(time.Time{}, time.Time{}, threshold, percentiles...)
+}
+
+// MetricsBetween computes the metrics over the window from from up to to. A
+// zero from or to means the start or end of the capture.
+func (c *Capture) MetricsBetween(from, to time.Time, threshold float64, percentiles ...float64) (Metrics, error) {
+	current := c.Find(MainCurrent)
+	if current == nil {
+		return Metrics{}, errors.New("capture: main current not recorded")
+	}
+	if from.IsZero() {
+		from = current.Start
+	}
+	if to.IsZero() {
+		to = current.End()
+	}
+	if len(percentiles) == 0 {
+		percentiles = DefaultPercentiles
+	}
+
+	m := Currents(current.Slice(from, to), threshold, percentiles...)
+	switch energy, voltage := c.Find(MainEnergy), c.Find(MainVoltage); {
+	case energy != nil:
+		m.Energy = EnergyDelta(energy.Slice(from, to))
+	case voltage != nil:
+		m.Energy = Energy(current.Slice(from, to), voltage)
+	default:
+		log.Println("Warning: no energy or voltage channel in capture, energy not computed")
+	}
+	return m, nil
+}
+
+// Currents computes the current metrics of a main current series. Energy is
+// left at zero since it needs the voltage.
+func Currents(current *Series, threshold float64, percentiles ...float64) Metrics {
+	m := Metrics{Duration: current.Duration().Seconds(), Threshold: threshold}
+	if current.Len() == 0 {
+		return m
+	}
+	m.PeakCurrent = current.Values[0]
+	m.MinCurrent = current.Values[0]
+	sum := 0.0
+	above := 0
+	for _, v := range current.Values {
+		sum += v
+		if v > m.PeakCurrent {
+			m.PeakCurrent = v
+		}
+		if v < m.MinCurrent {
+			m.MinCurrent = v
+		}
+		if v > threshold {
+			above++
+		}
+	}
+	m.AverageCurrent = sum / float64(current.Len())
+	m.Charge = sum * current.Interval.Hours() * 1000
+	m.TimeAboveThreshold = (time.Duration(above) * current.Interval).Seconds()
+
+	sorted := append([]float64(nil), current.Values...)
+	sort.Float64s(sorted)
+	for _, p := range percentiles {
+		m.Percentiles = append(m.Percentiles, Percentile{Percentile: p, Current: percentile(sorted, p)})
+	}
+	return m
+}
+
+// EnergyDelta returns the energy consumed over a cumulative energy series
+func EnergyDelta(energy *Series) float64 {
+	if energy.Len() == 0 {
+		return 0
+	}
+	// The first sample already includes the energy of its own interval
+	first := energy.Values[0]
+	if energy.Len() > 1 {
+		first -= energy.Values[1] - energy.Values[0]
+	}
+	return energy.Values[energy.Len()-1] - first
+}
+
+// Energy integrates current times voltage. The voltage is usually sampled
+// at a lower rate and is looked up by time.
+func Energy(current, voltage *Series) float64 {
+	if voltage.Len() == 0 {
+		return 0
+	}
+	energy := 0.0
+	for i, c := range current.Values {
+		j := voltage.Index(current.Time(i))
+		if j >= voltage.Len() {
+			j = voltage.Len() - 1
+		}
+		energy += c * voltage.Values[j]
+	}
+	return energy * current.Interval.Seconds()
+}
+
+// percentile returns the p'th percentile of sorted values using the nearest
+// rank
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p/100*float64(len(sorted)) + 0.5)
+	if i > 0 {
+		i--
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func (m Metrics) String() string {
+	s := fmt.Sprintf("duration %.3f s, energy %.4f J, average %.3f mA, peak %.3f mA, min %.3f mA, charge %.5f mAh, above %.1f mA for %.3f s",
+		m.Duration, m.Energy, m.AverageCurrent*1000, m.PeakCurrent*1000, m.MinCurrent*1000, m.Charge, m.Threshold*1000, m.TimeAboveThreshold)
+	for _, p := range m.Percentiles {
+		s += fmt.Sprintf(", p%g %.3f mA", p.Percentile, p.Current*1000)
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+package capture
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func near(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func TestCurrents(t *testing.T) {
+	start := time.Unix(0, 0)
+	tests := []struct {
+		name    string
+		values  []float64
+		average float64
+		peak    float64
+		min     float64
+		above   float64
+		p50     float64
+	}{
+		{"empty", nil, 0, 0, 0, 0, 0},
+		{"constant", []float64{0.005, 0.005, 0.005, 0.005}, 0.005, 0.005, 0.005, 0, 0.005},
+		{"burst", []float64{0.001, 0.002, 0.1, 0.2, 0.001, -0.001}, 0.0505, 0.2, -0.001, 2, 0.001},
+	}
+	for _, tt := range tests {
+		s := &Series{Start: start, Interval: time.Second, Values: tt.values}
+		m := Currents(s, 0.01, 50)
+		if !near(m.AverageCurrent, tt.average, 1e-12) || m.PeakCurrent != tt.peak || m.MinCurrent != tt.min {
+			t.Errorf("%s: average %g peak %g min %g, want %g %g %g", tt.name, m.AverageCurrent, m.PeakCurrent, m.MinCurrent, tt.average, tt.peak, tt.min)
+		}
+		if !near(m.TimeAboveThreshold, tt.above, 1e-9) {
+			t.Errorf("%s: above threshold for %v, want %v", tt.name, m.TimeAboveThreshold, tt.above)
+		}
+		if m.Duration != float64(len(tt.values)) {
+			t.Errorf("%s: duration %v", tt.name, m.Duration)
+		}
+		// Amperes times seconds to milliampere hours
+		if charge := tt.average * float64(len(tt.values)) / 3.6; !near(m.Charge, charge, 1e-12) {
+			t.Errorf("%s: charge %g mAh, want %g", tt.name, m.Charge, charge)
+		}
+		if len(tt.values) > 0 && (len(m.Percentiles) != 1 || m.Percentiles[0].Current != tt.p50) {
+			t.Errorf("%s: percentiles %v, want p50 %g", tt.name, m.Percentiles, tt.p50)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		p    float64
+		want float64
+	}{
+		{0, 1},
+		{10, 1},
+		{50, 5},
+		{90, 9},
+		{99, 10},
+		{100, 10},
+	}
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%g) = %g, want %g", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile of nothing = %g", got)
+	}
+}
+
+func TestEnergy(t *testing.T) {
+	start := time.Unix(0, 0)
+	// 10 mA at 3.6 V for 2 s, then 100 mA at 3.0 V for 2 s
+	current := &Series{Start: start, Interval: 500 * time.Millisecond, Values: []float64{0.01, 0.01, 0.01, 0.01, 0.1, 0.1, 0.1, 0.1}}
+	voltage := &Series{Start: start, Interval: time.Second, Values: []float64{3.6, 3.6, 3.0, 3.0}}
+	if got, want := Energy(current, voltage), 0.01*3.6*2+0.1*3.0*2; !near(got, want, 1e-12) {
+		t.Errorf("Energy() = %g, want %g", got, want)
+	}
+
+	// The cumulative energy series starts after the first interval
+	energy := &Series{Start: start, Interval: time.Second, Values: []float64{0.5, 1, 1.5, 2}}
+	if got := EnergyDelta(energy); !near(got, 2, 1e-12) {
+		t.Errorf("EnergyDelta() = %g, want 2", got)
+	}
+	if got := EnergyDelta(&Series{}); got != 0 {
+		t.Errorf("EnergyDelta() of nothing = %g", got)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	tests := []struct {
+		filename string
+		energy   float64
+		average  float64
+		peak     float64
+		above    float64
+	}{
+		{sendCapture, 0.3586, 3.625e-3, 306.828e-3, 1.949},
+		{sendReceiveCapture, 0.6092, 6.157e-3, 301.877e-3, 3.11575},
+	}
+	for _, tt := range tests {
+		c := openFixture(t, tt.filename)
+		m, err := c.Metrics(0.01)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !near(m.Energy, tt.energy, 1e-4) || !near(m.AverageCurrent, tt.average, 1e-6) || !near(m.PeakCurrent, tt.peak, 1e-6) {
+			t.Errorf("%s: energy %g J average %g A peak %g A, want %g %g %g", tt.filename, m.Energy, m.AverageCurrent, m.PeakCurrent, tt.energy, tt.average, tt.peak)
+		}
+		if !near(m.TimeAboveThreshold, tt.above, 1e-9) {
+			t.Errorf("%s: above threshold for %v, want %v", tt.filename, m.TimeAboveThreshold, tt.above)
+		}
+		if len(m.Percentiles) != len(DefaultPercentiles) {
+			t.Errorf("%s: percentiles %v", tt.filename, m.Percentiles)
+		}
+
+		// The halves of the capture add up to the whole
+		current := c.Find(MainCurrent)
+		middle := current.Start.Add(current.Duration() / 2)
+		first, err := c.MetricsBetween(time.Time{}, middle, 0.01)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := c.MetricsBetween(middle, time.Time{}, 0.01)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !near(first.Energy+second.Energy, m.Energy, 1e-3) || !near(first.TimeAboveThreshold+second.TimeAboveThreshold, m.TimeAboveThreshold, 1e-9) {
+			t.Errorf("%s: halves %g J + %g J, want %g J", tt.filename, first.Energy, second.Energy, m.Energy)
+		}
+	}
+}
+
+func TestMetricsWithoutCurrent(t *testing.T) {
+	c := &Capture{}
+	if _, err := c.Metrics(0.01); err == nil {
+		t.Error("Metrics() succeeded without a main current channel")
+	}
+}
@@ -0,0 +1,289 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// State is a power state of the device under test
+type State string
+
+const (
+	// StateSleep is PSM sleep or any other floor current
+	StateSleep State = "psm-sleep"
+	// StatePaging is a short wake-up without transmission, e.g. idle or eDRX
+	// paging
+	StatePaging State = "paging"
+	// StateConnected is from wake-up to the last transmission burst
+	StateConnected State = "connected"
+	// StateRelease is the tail after the last transmission burst until the
+	// RRC connection is released and the device goes back to sleep
+	StateRelease State = "rrc-release"
+)
+
+// Phase is a period the device spent in one power state
+type Phase struct {
+	State          State     `json:"state"`
+	Start          time.Time `json:"start"`
+	Duration       float64   `json:"duration_s"`
+	Energy         float64   `json:"energy_j"`
+	Charge         float64   `json:"charge_mah"`
+	AverageCurrent float64   `json:"average_current_a"`
+}
+
+// SegmentOptions tunes the phase segmentation. A zero Window or NoiseFloor
+// is replaced by the default.
+type SegmentOptions struct {
+	// Window is the length of the windows the current is averaged over
+	// before it's classified. It's rounded down to whole samples, at least
+	// one.
+	Window time.Duration
+	// MinGap is the shortest sleep kept between two active periods. Shorter
+	// gaps are merged into the surrounding activity.
+	MinGap time.Duration
+	// MinTXCurrent is the lowest current counted as a transmission burst
+	// regardless of the clustering
+	MinTXCurrent float64
+	// NoiseFloor is the current window averages are clamped to before
+	// clustering, since the sleep current is close to the measurement noise
+	NoiseFloor float64
+}
+
+// DefaultSegmentOptions works for the SARA modules
+var DefaultSegmentOptions = SegmentOptions{
+	Window:       10 * time.Millisecond,
+	MinGap:       100 * time.Millisecond,
+	MinTXCurrent: 0.02,
+	NoiseFloor:   50e-6,
+}
+
+// withDefaults returns the options with the defaults for the zero options
+func (o SegmentOptions) withDefaults() (SegmentOptions, error) {
+	if o.Window < 0 || o.MinGap < 0 || o.MinTXCurrent < 0 || o.NoiseFloor < 0 {
+		return o, errors.New("capture: negative segment option")
+	}
+	if o.Window == 0 {
+		o.Window = DefaultSegmentOptions.Window
+	}
+	if o.NoiseFloor == 0 {
+		o.NoiseFloor = DefaultSegmentOptions.NoiseFloor
+	}
+	return o, nil
+}
+
+// level is the classification of one window
+type level int
+
+const (
+	levelLow level = iota
+	levelMid
+	levelHigh
+)
+
+// Segment splits the capture into power state phases. The window averages
+// are clustered into low, mid and high current levels, and the edges between
+// low and higher levels delimit active periods. Active periods with high
+// level bursts are connected periods followed by an RRC release tail, the
+// rest are paging.
+func (c *Capture) Segment(opts SegmentOptions) ([]Phase, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	current := c.Find(MainCurrent)
+	if current == nil {
+		return nil, errors.New("capture: main current not recorded")
+	}
+	if current.Interval <= 0 {
+		return nil, errors.New("capture: invalid sample interval")
+	}
+	perWindow := int(opts.Window / current.Interval)
+	if perWindow < 1 {
+		perWindow = 1
+	}
+	windows := (current.Len() + perWindow - 1) / perWindow
+	if windows == 0 {
+		return nil, nil
+	}
+
+	logs := make([]float64, windows)
+	for w := range logs {
+		from, to := w*perWindow, (w+1)*perWindow
+		if to > current.Len() {
+			to = current.Len()
+		}
+		sum := 0.0
+		for _, v := range current.Values[from:to] {
+			sum += v
+		}
+		logs[w] = math.Log10(math.Max(sum/float64(to-from), opts.NoiseFloor))
+	}
+
+	centers := kmeans(logs, 3)
+	lowMid := (centers[0] + centers[1]) / 2
+	midHigh := math.Max((centers[1]+centers[2])/2, math.Log10(opts.MinTXCurrent))
+	levels := make([]level, windows)
+	for w, l := range logs {
+		switch {
+		case l >= midHigh:
+			levels[w] = levelHigh
+		case l >= lowMid:
+			levels[w] = levelMid
+		default:
+			levels[w] = levelLow
+		}
+	}
+
+	// Fill short gaps so that the wake-up sequence isn't split up
+	minGap := int(opts.MinGap / (time.Duration(perWindow) * current.Interval))
+	for start := 0; start < windows; {
+		if levels[start] != levelLow {
+			start++
+			continue
+		}
+		end := start
+		for end < windows && levels[end] == levelLow {
+			end++
+		}
+		if start > 0 && end < windows && end-start < minGap {
+			for w := start; w < end; w++ {
+				levels[w] = levelMid
+			}
+		}
+		start = end
+	}
+
+	// The last window may be partial, so the last phase ends with the capture
+	windowTime := func(w int) time.Time {
+		if w*perWindow > current.Len() {
+			return current.End()
+		}
+		return current.Time(w * perWindow)
+	}
+	var phases []Phase
+	add := func(state State, from, to int) {
+		if to <= from {
+			return
+		}
+		phases = append(phases, c.phase(state, windowTime(from), windowTime(to)))
+	}
+	for start := 0; start < windows; {
+		active := levels[start] != levelLow
+		end := start
+		lastHigh := -1
+		for end < windows && (levels[end] != levelLow) == active {
+			if levels[end] == levelHigh {
+				lastHigh = end
+			}
+			end++
+		}
+		switch {
+		case !active:
+			add(StateSleep, start, end)
+		case lastHigh >= 0:
+			add(StateConnected, start, lastHigh+1)
+			add(StateRelease, lastHigh+1, end)
+		default:
+			add(StatePaging, start, end)
+		}
+		start = end
+	}
+	return phases, nil
+}
+
+// phase computes the energy and charge of a phase
+func (c *Capture) phase(state State, from, to time.Time) Phase {
+	p := Phase{State: state, Start: from, Duration: to.Sub(from).Seconds()}
+	m, err := c.MetricsBetween(from, to, 0)
+	if err != nil {
+		return p
+	}
+	p.Energy = m.Energy
+	p.Charge = m.Charge
+	p.AverageCurrent = m.AverageCurrent
+	return p
+}
+
+// PhaseSummary is the total time and energy spent in one state
+type PhaseSummary struct {
+	State    State   `json:"state"`
+	Count    int     `json:"count"`
+	Duration float64 `json:"duration_s"`
+	Energy   float64 `json:"energy_j"`
+	Charge   float64 `json:"charge_mah"`
+}
+
+// Summarize sums up the phases per state
+func Summarize(phases []Phase) []PhaseSummary {
+	var summaries []PhaseSummary
+	index := make(map[State]int)
+	for _, p := range phases {
+		i, ok := index[p.State]
+		if !ok {
+			i = len(summaries)
+			index[p.State] = i
+			summaries = append(summaries, PhaseSummary{State: p.State})
+		}
+		summaries[i].Count++
+		summaries[i].Duration += p.Duration
+		summaries[i].Energy += p.Energy
+		summaries[i].Charge += p.Charge
+	}
+	return summaries
+}
+
+func (p Phase) String() string {
+	return fmt.Sprintf("%-12s %s %9.3f s %9.4f J %9.3f mA", p.State, p.Start.Format("15:04:05.000"), p.Duration, p.Energy, p.AverageCurrent*1000)
+}
+
+// kmeans clusters values in one dimension and returns the k sorted cluster
+// centers
+func kmeans(values []float64, k int) []float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	centers := make([]float64, k)
+	// Start with the extremes and evenly spread quantiles in between, so that
+	// the short bursts get a cluster even though the captures are mostly sleep
+	for i := range centers {
+		q := (float64(i) + 0.5) / float64(k)
+		centers[i] = sorted[int(q*float64(len(sorted)-1))]
+	}
+	centers[0] = sorted[0]
+	centers[k-1] = sorted[len(sorted)-1]
+
+	sums := make([]float64, k)
+	counts := make([]int, k)
+	for iter := 0; iter < 50; iter++ {
+		for i := range sums {
+			sums[i], counts[i] = 0, 0
+		}
+		for _, v := range values {
+			nearest := 0
+			for i := range centers {
+				if math.Abs(v-centers[i]) < math.Abs(v-centers[nearest]) {
+					nearest = i
+				}
+			}
+			sums[nearest] += v
+			counts[nearest]++
+		}
+		changed := false
+		for i := range centers {
+			if counts[i] == 0 {
+				continue
+			}
+			if c := sums[i] / float64(counts[i]); c != centers[i] {
+				centers[i] = c
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	sort.Float64s(centers)
+	return centers
+}
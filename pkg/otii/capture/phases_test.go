@@ -0,0 +1,154 @@
+package capture
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSegment(t *testing.T) {
+	tests := []struct {
+		filename string
+		phases   int
+		counts   map[State]int
+	}{
+		// Three packets, of which the last two share a connection
+		{sendCapture, 13, map[State]int{StateSleep: 6, StatePaging: 3, StateConnected: 2, StateRelease: 2}},
+		// Three packets and their echoes
+		{sendReceiveCapture, 22, map[State]int{StateSleep: 10, StatePaging: 6, StateConnected: 3, StateRelease: 3}},
+	}
+	for _, tt := range tests {
+		c := openFixture(t, tt.filename)
+		phases, err := c.Segment(DefaultSegmentOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(phases) != tt.phases {
+			t.Errorf("%s: %d phases, want %d", tt.filename, len(phases), tt.phases)
+		}
+
+		// The phases are contiguous and cover the capture
+		current := c.Find(MainCurrent)
+		at := current.Start
+		for _, p := range phases {
+			if !p.Start.Equal(at) {
+				t.Errorf("%s: phase %v starts at %v, want %v", tt.filename, p, p.Start, at)
+			}
+			at = p.Start.Add(time.Duration(math.Round(p.Duration * float64(time.Second))))
+		}
+		if !at.Equal(current.End()) {
+			t.Errorf("%s: phases end at %v, want %v", tt.filename, at, current.End())
+		}
+
+		// Connected phases are followed by their release tail
+		for i, p := range phases {
+			if p.State == StateConnected && (i+1 == len(phases) || phases[i+1].State != StateRelease) {
+				t.Errorf("%s: connected phase %d isn't followed by a release", tt.filename, i)
+			}
+		}
+
+		total := 0.0
+		for _, s := range Summarize(phases) {
+			if s.Count != tt.counts[s.State] {
+				t.Errorf("%s: %d %s phases, want %d", tt.filename, s.Count, s.State, tt.counts[s.State])
+			}
+			total += s.Energy
+		}
+		m, err := c.Metrics(0.01)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !near(total, m.Energy, 0.01) {
+			t.Errorf("%s: phases add up to %g J, want %g J", tt.filename, total, m.Energy)
+		}
+	}
+}
+
+func TestSegmentOptions(t *testing.T) {
+	c := openFixture(t, sendCapture)
+	interval := c.Find(MainCurrent).Interval
+
+	// Windows shorter than a sample are one sample long, and the gaps are
+	// measured in those windows
+	short := DefaultSegmentOptions
+	short.Window = time.Nanosecond
+	got, err := c.Segment(short)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := DefaultSegmentOptions
+	sample.Window = interval
+	want, err := c.Segment(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%d phases with a window shorter than a sample, want %d", len(got), len(want))
+	}
+
+	// The zero window and noise floor are the defaults
+	zero := DefaultSegmentOptions
+	zero.Window, zero.NoiseFloor = 0, 0
+	got, err = c.Segment(zero)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err = c.Segment(DefaultSegmentOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%d phases with zero options, want %d", len(got), len(want))
+	}
+	if _, err := c.Segment(SegmentOptions{}); err != nil {
+		t.Errorf("Segment() with no options: %v", err)
+	}
+
+	if _, err := c.Segment(SegmentOptions{Window: -time.Millisecond}); err == nil {
+		t.Error("Segment() with a negative window succeeded")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	phases := []Phase{
+		{State: StateSleep, Duration: 4, Energy: 0.001, Charge: 0.0001},
+		{State: StateConnected, Duration: 2, Energy: 0.2, Charge: 0.02},
+		{State: StateRelease, Duration: 1, Energy: 0.02, Charge: 0.002},
+		{State: StateSleep, Duration: 6, Energy: 0.002, Charge: 0.0002},
+	}
+	want := []PhaseSummary{
+		{State: StateSleep, Count: 2, Duration: 10, Energy: 0.003, Charge: 0.0003},
+		{State: StateConnected, Count: 1, Duration: 2, Energy: 0.2, Charge: 0.02},
+		{State: StateRelease, Count: 1, Duration: 1, Energy: 0.02, Charge: 0.002},
+	}
+	got := Summarize(phases)
+	if len(got) != len(want) {
+		t.Fatalf("Summarize() = %v, want %v", got, want)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.State != w.State || g.Count != w.Count || !near(g.Duration, w.Duration, 1e-12) || !near(g.Energy, w.Energy, 1e-12) || !near(g.Charge, w.Charge, 1e-12) {
+			t.Errorf("summary %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestKmeans(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   []float64
+	}{
+		{[]float64{1, 1, 1, 5, 5, 9, 9, 9}, []float64{1, 5, 9}},
+		{[]float64{0.1, 0.2, 10.1, 10.2, 20.1, 20.2}, []float64{0.15, 10.15, 20.15}},
+	}
+	for _, tt := range tests {
+		got := kmeans(tt.values, 3)
+		for i := range tt.want {
+			if !near(got[i], tt.want[i], 1e-9) {
+				t.Errorf("kmeans(%v) = %v, want %v", tt.values, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package otii
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// CLIEnv is the environment variable checked for the otiicli path
+const CLIEnv = "OTII_CLI"
+
+// defaultCLIPaths are the usual install locations of otiicli per GOOS
+var defaultCLIPaths = map[string][]string{
+	"darwin":  {"/Applications/otii.app/Contents/MacOS/otiicli"},
+	"linux":   {"/opt/otii/otiicli", "/usr/local/bin/otiicli"},
+	"windows": {`C:\Program Files\Otii\otiicli.exe`, `C:\Program Files (x86)\Otii\otiicli.exe`},
+}
+
+var (
+	cliPath   = defaultCLIPath()
+	dryRunDir string
+
+	dryRunMutex sync.Mutex
+	dryRunCount int
+)
+
+func defaultCLIPath() string {
+	paths := defaultCLIPaths[runtime.GOOS]
+	if len(paths) == 0 {
+		return "otiicli"
+	}
+	return paths[0]
+}
+
+// FindCLI locates otiicli. An explicit path is used as is, otherwise the
+// OTII_CLI environment variable, PATH and the default install locations for
+// the current OS are tried in that order.
+func FindCLI(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	if env := os.Getenv(CLIEnv); env != "" {
+		return env, nil
+	}
+	if p, err := exec.LookPath("otiicli"); err == nil {
+		return p, nil
+	}
+	for _, p := range defaultCLIPaths[runtime.GOOS] {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", errors.New("otiicli not found, set it with -otiicli or " + CLIEnv)
+}
+
+// SetCLI sets the otiicli used to run scripts, see FindCLI
+func SetCLI(path string) error {
+	p, err := FindCLI(path)
+	if err != nil {
+		return err
+	}
+	cliPath = p
+	if enabled && dryRunDir == "" {
+		log.Println("Using otiicli at", cliPath)
+	}
+	return nil
+}
+
+// SetDryRun makes Run write the scripts to dir instead of executing them.
+// An empty dir turns dry-run off.
+func SetDryRun(dir string) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		log.Println("Otii dry-run, writing scripts to", dir)
+	}
+	dryRunDir = dir
+	return nil
+}
+
+// fileTimeFormat is the time in filenames, without the colons Windows doesn't
+// allow
+const fileTimeFormat = "20060102T150405"
+
+func writeDryRunScript(script string) error {
+	dryRunMutex.Lock()
+	dryRunCount++
+	n := dryRunCount
+	dryRunMutex.Unlock()
+
+	filename := filepath.Join(dryRunDir, fmt.Sprintf("otii-%s-%03d.lua", time.Now().Format(fileTimeFormat), n))
+	if err := ioutil.WriteFile(filename, []byte(script), 0644); err != nil {
+		log.Println("Error writing script:", err)
+		return err
+	}
+	log.Println("Otii script written to", filename)
+	return nil
+}
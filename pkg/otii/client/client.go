@@ -0,0 +1,285 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultAddress is the address the Otii TCP server listens to by default
+const DefaultAddress = "127.0.0.1:1905"
+
+// Client is a client for the Otii TCP server JSON API
+type Client struct {
+	conn    net.Conn
+	decoder *json.Decoder
+	mutex   sync.Mutex
+	transID int
+}
+
+// Device is an Otii device connected to the server
+type Device struct {
+	Type   string `json:"type"`
+	ID     string `json:"device_id"`
+	Name   string `json:"name"`
+	Serial string `json:"serial"`
+}
+
+// Data is a block of samples from a recording channel
+type Data struct {
+	// Timestamp is the time of the first sample in seconds from the start of
+	// the recording
+	Timestamp float64 `json:"timestamp"`
+	// Interval is the time between samples in seconds
+	Interval float64   `json:"interval"`
+	Values   []float64 `json:"values"`
+}
+
+type request struct {
+	Type    string      `json:"type"`
+	Cmd     string      `json:"cmd"`
+	TransID string      `json:"trans_id"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type response struct {
+	Type      string          `json:"type"`
+	Cmd       string          `json:"cmd"`
+	TransID   string          `json:"trans_id"`
+	ErrorCode string          `json:"errorcode"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Error is an error returned by the Otii server
+type Error struct {
+	Cmd     string
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("otii: %s failed: %s (%s)", e.Cmd, e.Message, e.Code)
+}
+
+// Dial connects to an Otii TCP server
+func Dial(address string) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		conn:    conn,
+		decoder: json.NewDecoder(conn),
+	}, nil
+}
+
+// Close closes the connection to the server
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Devices returns the devices connected to the server
+func (c *Client) Devices(timeout time.Duration) ([]Device, error) {
+	var res struct {
+		Devices []Device `json:"devices"`
+	}
+	err := c.request("otii_get_devices", map[string]interface{}{"timeout": timeout.Seconds()}, &res)
+	return res.Devices, err
+}
+
+// Calibrate calibrates an Arc
+func (c *Client) Calibrate(deviceID string) error {
+	return c.request("arc_calibrate", device{ID: deviceID}, nil)
+}
+
+// SetMainVoltage sets the main output voltage of an Arc
+func (c *Client) SetMainVoltage(deviceID string, volts float64) error {
+	return c.request("arc_set_main_voltage", deviceValue{ID: deviceID, Value: volts}, nil)
+}
+
+// SetMaxCurrent sets the overcurrent limit of an Arc
+func (c *Client) SetMaxCurrent(deviceID string, amps float64) error {
+	return c.request("arc_set_max_current", deviceValue{ID: deviceID, Value: amps}, nil)
+}
+
+// SetADCResistor sets the shunt resistor in ohms used for the ADC current
+func (c *Client) SetADCResistor(deviceID string, ohms float64) error {
+	return c.request("arc_set_adc_resistor", deviceValue{ID: deviceID, Value: ohms}, nil)
+}
+
+// SetSampleRate sets the sample rate in samples per second
+func (c *Client) SetSampleRate(deviceID string, rate int) error {
+	return c.request("arc_set_sample_rate", deviceValue{ID: deviceID, Value: float64(rate)}, nil)
+}
+
+// SetRange sets the main current range of an Arc, "low" or "high"
+func (c *Client) SetRange(deviceID string, currentRange string) error {
+	return c.request("arc_set_range", map[string]interface{}{"device_id": deviceID, "range": currentRange}, nil)
+}
+
+// EnableChannel enables or disables a recording channel, e.g. "mc" for main
+// current or "mv" for main voltage
+func (c *Client) EnableChannel(deviceID string, channel string, enable bool) error {
+	return c.request("arc_enable_channel", map[string]interface{}{"device_id": deviceID, "channel": channel, "enable": enable}, nil)
+}
+
+// SetMainPower turns the main power output of an Arc on or off
+func (c *Client) SetMainPower(deviceID string, enable bool) error {
+	return c.request("arc_set_main", map[string]interface{}{"device_id": deviceID, "enable": enable}, nil)
+}
+
+// CreateProject creates a new project and returns its id
+func (c *Client) CreateProject() (int, error) {
+	var res struct {
+		ProjectID int `json:"project_id"`
+	}
+	err := c.request("otii_create_project", nil, &res)
+	return res.ProjectID, err
+}
+
+// StartRecording starts a new recording in a project
+func (c *Client) StartRecording(projectID int) error {
+	return c.request("project_start", project{ID: projectID}, nil)
+}
+
+// StopRecording stops the running recording in a project
+func (c *Client) StopRecording(projectID int) error {
+	return c.request("project_stop", project{ID: projectID}, nil)
+}
+
+// SaveProject saves a project. The filename is relative to the server.
+func (c *Client) SaveProject(projectID int, filename string) error {
+	return c.request("project_save", map[string]interface{}{"project_id": projectID, "filename": filename, "force_overwrite": true}, nil)
+}
+
+// CloseProject closes a project without saving it
+func (c *Client) CloseProject(projectID int) error {
+	return c.request("project_close", map[string]interface{}{"project_id": projectID, "force": true}, nil)
+}
+
+// LastRecording returns the id of the last recording in a project
+func (c *Client) LastRecording(projectID int) (int, error) {
+	var res struct {
+		RecordingID int `json:"recording_id"`
+	}
+	err := c.request("project_get_last_recording", project{ID: projectID}, &res)
+	return res.RecordingID, err
+}
+
+// DataCount returns the number of samples recorded on a channel
+func (c *Client) DataCount(recordingID int, deviceID string, channel string) (int, error) {
+	var res struct {
+		Count int `json:"count"`
+	}
+	err := c.request("recording_get_channel_data_count", channelData{RecordingID: recordingID, DeviceID: deviceID, Channel: channel}, &res)
+	return res.Count, err
+}
+
+// Data returns count samples from a channel starting at index
+func (c *Client) Data(recordingID int, deviceID string, channel string, index, count int) (Data, error) {
+	var res struct {
+		Data Data `json:"data"`
+	}
+	err := c.request("recording_get_channel_data", channelData{
+		RecordingID: recordingID,
+		DeviceID:    deviceID,
+		Channel:     channel,
+		Index:       index,
+		Count:       count,
+	}, &res)
+	return res.Data, err
+}
+
+// Stream reads all samples on a channel from index in blocks of blockSize
+// and calls fn with each block until the samples are exhausted or fn returns
+// false. It can be used while recording to follow the channel as it grows.
+func (c *Client) Stream(recordingID int, deviceID string, channel string, index, blockSize int, fn func(Data) bool) error {
+	for {
+		count, err := c.DataCount(recordingID, deviceID, channel)
+		if err != nil {
+			return err
+		}
+		if index >= count {
+			return nil
+		}
+		n := count - index
+		if n > blockSize {
+			n = blockSize
+		}
+		data, err := c.Data(recordingID, deviceID, channel, index, n)
+		if err != nil {
+			return err
+		}
+		if !fn(data) {
+			return nil
+		}
+		index += n
+	}
+}
+
+type device struct {
+	ID string `json:"device_id"`
+}
+
+type deviceValue struct {
+	ID    string  `json:"device_id"`
+	Value float64 `json:"value"`
+}
+
+type project struct {
+	ID int `json:"project_id"`
+}
+
+type channelData struct {
+	RecordingID int    `json:"recording_id"`
+	DeviceID    string `json:"device_id"`
+	Channel     string `json:"channel"`
+	Index       int    `json:"index"`
+	Count       int    `json:"count"`
+}
+
+func (c *Client) request(cmd string, data interface{}, result interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.transID++
+	req := request{Type: "request", Cmd: cmd, TransID: strconv.Itoa(c.transID), Data: data}
+	buf, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return err
+	}
+
+	for {
+		var res response
+		if err := c.decoder.Decode(&res); err != nil {
+			return err
+		}
+		// The server also sends information messages, e.g. when devices are
+		// connected, which aren't replies to this request
+		if res.TransID != req.TransID {
+			continue
+		}
+		switch res.Type {
+		case "response":
+			if result == nil || len(res.Data) == 0 {
+				return nil
+			}
+			return json.Unmarshal(res.Data, result)
+		case "error":
+			var msg struct {
+				Message string `json:"message"`
+			}
+			json.Unmarshal(res.Data, &msg)
+			return &Error{Cmd: cmd, Code: res.ErrorCode, Message: msg.Message}
+		default:
+			return errors.New("otii: unexpected message type " + res.Type)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer is a local Otii TCP server answering requests with handle
+type fakeServer struct {
+	listener net.Listener
+	handle   func(cmd string, data map[string]interface{}) (interface{}, *Error)
+
+	mutex sync.Mutex
+	cmds  []string
+}
+
+func newFakeServer(t *testing.T, handle func(cmd string, data map[string]interface{}) (interface{}, *Error)) *fakeServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{listener: l, handle: handle}
+	go s.serve()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func (s *fakeServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var req struct {
+			Type    string                 `json:"type"`
+			Cmd     string                 `json:"cmd"`
+			TransID string                 `json:"trans_id"`
+			Data    map[string]interface{} `json:"data"`
+		}
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.cmds = append(s.cmds, req.Cmd)
+		s.mutex.Unlock()
+
+		// The real server sends information messages at any time
+		enc.Encode(map[string]interface{}{"type": "information", "cmd": "otii_on_device_connected"})
+
+		data, e := s.handle(req.Cmd, req.Data)
+		if e != nil {
+			enc.Encode(map[string]interface{}{
+				"type":      "error",
+				"cmd":       req.Cmd,
+				"trans_id":  req.TransID,
+				"errorcode": e.Code,
+				"data":      map[string]string{"message": e.Message},
+			})
+			continue
+		}
+		enc.Encode(map[string]interface{}{"type": "response", "cmd": req.Cmd, "trans_id": req.TransID, "data": data})
+	}
+}
+
+func (s *fakeServer) commands() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.cmds...)
+}
+
+func dial(t *testing.T, s *fakeServer) *Client {
+	t.Helper()
+	c, err := Dial(s.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestDevices(t *testing.T) {
+	s := newFakeServer(t, func(cmd string, data map[string]interface{}) (interface{}, *Error) {
+		if cmd != "otii_get_devices" {
+			return nil, &Error{Code: "Unknown command"}
+		}
+		if data["timeout"] != 3.0 {
+			return nil, &Error{Code: "Invalid parameter", Message: "timeout"}
+		}
+		return map[string]interface{}{"devices": []map[string]string{
+			{"type": "Arc", "device_id": "1", "name": "Arc", "serial": "AR0001"},
+			{"type": "Arc", "device_id": "2", "name": "Arc 2", "serial": "AR0002"},
+		}}, nil
+	})
+	devices, err := dial(t, s).Devices(3 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Device{
+		{Type: "Arc", ID: "1", Name: "Arc", Serial: "AR0001"},
+		{Type: "Arc", ID: "2", Name: "Arc 2", Serial: "AR0002"},
+	}
+	if !reflect.DeepEqual(devices, want) {
+		t.Errorf("Devices() = %+v, want %+v", devices, want)
+	}
+}
+
+func TestRecording(t *testing.T) {
+	s := newFakeServer(t, func(cmd string, data map[string]interface{}) (interface{}, *Error) {
+		switch cmd {
+		case "otii_create_project":
+			return map[string]int{"project_id": 7}, nil
+		case "project_start", "project_stop":
+			if data["project_id"] != 7.0 {
+				return nil, &Error{Code: "Invalid project"}
+			}
+			return nil, nil
+		case "project_get_last_recording":
+			return map[string]int{"recording_id": 3}, nil
+		}
+		return nil, &Error{Code: "Unknown command"}
+	})
+	c := dial(t, s)
+
+	id, err := c.CreateProject()
+	if err != nil || id != 7 {
+		t.Fatalf("CreateProject() = %d, %v, want 7", id, err)
+	}
+	if err := c.StartRecording(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.StopRecording(id); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := c.LastRecording(id)
+	if err != nil || rec != 3 {
+		t.Errorf("LastRecording() = %d, %v, want 3", rec, err)
+	}
+	want := []string{"otii_create_project", "project_start", "project_stop", "project_get_last_recording"}
+	if cmds := s.commands(); !reflect.DeepEqual(cmds, want) {
+		t.Errorf("commands = %v, want %v", cmds, want)
+	}
+}
+
+func TestErrorReply(t *testing.T) {
+	s := newFakeServer(t, func(cmd string, data map[string]interface{}) (interface{}, *Error) {
+		return nil, &Error{Code: "Device not found", Message: "no device with id 9"}
+	})
+	err := dial(t, s).SetMainPower("9", true)
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("SetMainPower() error = %v, want *Error", err)
+	}
+	want := Error{Cmd: "arc_set_main", Code: "Device not found", Message: "no device with id 9"}
+	if *e != want {
+		t.Errorf("error = %+v, want %+v", *e, want)
+	}
+}
+
+func TestStream(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5, 6, 7}
+	s := newFakeServer(t, func(cmd string, data map[string]interface{}) (interface{}, *Error) {
+		switch cmd {
+		case "recording_get_channel_data_count":
+			return map[string]int{"count": len(values)}, nil
+		case "recording_get_channel_data":
+			index, count := int(data["index"].(float64)), int(data["count"].(float64))
+			return map[string]interface{}{"data": Data{
+				Timestamp: float64(index) * 0.001,
+				Interval:  0.001,
+				Values:    values[index : index+count],
+			}}, nil
+		}
+		return nil, &Error{Code: "Unknown command"}
+	})
+
+	var got []float64
+	var blocks int
+	err := dial(t, s).Stream(1, "1", "mc", 0, 3, func(d Data) bool {
+		blocks++
+		got = append(got, d.Values...)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, values) || blocks != 3 {
+		t.Errorf("Stream() read %v in %d blocks, want %v in 3", got, blocks, values)
+	}
+}
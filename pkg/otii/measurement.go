@@ -0,0 +1,102 @@
+package otii
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Measurement is the Arc configuration used when recording
+type Measurement struct {
+	// MainVoltage is the supply voltage in volts
+	MainVoltage float64 `json:"main_voltage"`
+	// Range is the main current range, "low" or "high"
+	Range string `json:"range"`
+	// MaxCurrent is the overcurrent limit in amperes
+	MaxCurrent float64 `json:"max_current"`
+	// Channels are the recorded channels, e.g. "mc" and "mv" for main
+	// current and voltage, "ac" and "av" for ADC current and voltage and
+	// "i1" and "i2" for the digital inputs
+	Channels []string `json:"channels"`
+	// ADCResistor is the shunt resistor in ohms used for the ADC current.
+	// Zero leaves the Arc setting untouched.
+	ADCResistor float64 `json:"adc_resistor,omitempty"`
+	// SampleRate in samples per second. Zero leaves the Arc default.
+	SampleRate int `json:"sample_rate,omitempty"`
+	// Filename is the capture filename template, see CaptureFilename
+	Filename string `json:"filename"`
+	// Battery steps the main voltage during the recording when set
+	Battery *BatteryProfile `json:"battery,omitempty"`
+}
+
+// DefaultMeasurement is the configuration used for the SARA modules
+var DefaultMeasurement = Measurement{
+	MainVoltage: 3.3,
+	Range:       "high",
+	MaxCurrent:  0.5,
+	Channels:    []string{"mc", "mv"},
+	Filename:    "captures/capture_{type}_{scenario}_{time}.otii",
+}
+
+var validChannels = map[string]bool{
+	"mc": true, "mv": true, "me": true,
+	"ac": true, "av": true, "ae": true,
+	"i1": true, "i2": true,
+	"sp": true, "sn": true, "vb": true, "vj": true, "tp": true,
+}
+
+// Validate checks the configuration against the limits of the Arc
+func (m Measurement) Validate() error {
+	if m.MainVoltage < 0.5 || m.MainVoltage > 4.2 {
+		return fmt.Errorf("main voltage %g V out of range 0.5-4.2 V", m.MainVoltage)
+	}
+	if m.Range != "low" && m.Range != "high" {
+		return fmt.Errorf("invalid range %q, must be low or high", m.Range)
+	}
+	if m.MaxCurrent < 0.001 || m.MaxCurrent > 5 {
+		return fmt.Errorf("max current %g A out of range 0.001-5 A", m.MaxCurrent)
+	}
+	if len(m.Channels) == 0 {
+		return fmt.Errorf("no channels enabled")
+	}
+	for _, ch := range m.Channels {
+		if !validChannels[ch] {
+			return fmt.Errorf("unknown channel %q", ch)
+		}
+	}
+	if m.ADCResistor < 0 || m.SampleRate < 0 {
+		return fmt.Errorf("negative ADC resistor or sample rate")
+	}
+	if m.Battery != nil {
+		return m.Battery.validate()
+	}
+	return nil
+}
+
+// CaptureFilename expands the filename template. {time} is replaced with the
+// current time and {key} with vars[key].
+func (m Measurement) CaptureFilename(vars map[string]string) string {
+	pairs := []string{"{time}", time.Now().Format(fileTimeFormat)}
+	for k, v := range vars {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(m.Filename)
+}
+
+// script returns the Lua statements configuring box
+func (m Measurement) script(box string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:set_main_voltage(%g)\n", box, m.MainVoltage)
+	fmt.Fprintf(&b, "%s:set_range(%q)\n", box, m.Range)
+	fmt.Fprintf(&b, "%s:set_max_current(%g)\n", box, m.MaxCurrent)
+	if m.ADCResistor > 0 {
+		fmt.Fprintf(&b, "%s:set_adc_resistor(%g)\n", box, m.ADCResistor)
+	}
+	if m.SampleRate > 0 {
+		fmt.Fprintf(&b, "%s:set_sample_rate(%d)\n", box, m.SampleRate)
+	}
+	for _, ch := range m.Channels {
+		fmt.Fprintf(&b, "%s:enable_channel(%q, true)\n", box, ch)
+	}
+	return b.String()
+}
@@ -0,0 +1,14 @@
+package otii
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestCaptureFilename(t *testing.T) {
+	got := DefaultMeasurement.CaptureFilename(map[string]string{"type": "n2", "scenario": "send"})
+	// The time has no colons, which Windows doesn't allow in filenames
+	if !regexp.MustCompile(`^captures/capture_n2_send_\d{8}T\d{6}\.otii$`).MatchString(got) {
+		t.Errorf("CaptureFilename() = %s", got)
+	}
+}
@@ -1,6 +1,7 @@
 package otii
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
@@ -9,9 +10,24 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/otii/client"
 )
 
-var enabled bool
+var (
+	enabled bool
+	// server is set when the Otii is controlled through the TCP server
+	// rather than by running Lua scripts with otiicli
+	server *client.Client
+	// selected is the Arc used by default, see SelectDevice
+	selected string
+)
+
+// Device is an Otii Arc
+type Device struct {
+	ID   string
+	Name string
+}
 
 func Init(enable bool) {
 	enabled = enable
@@ -20,24 +36,79 @@ func Init(enable bool) {
 	}
 }
 
-func EnableMainPower() error {
+// Connect makes the package control the Otii through the TCP server at
+// address instead of otiicli
+func Connect(address string) error {
 	if !enabled {
 		return nil
 	}
-	log.Println("Enabling main power")
-	if err := Run("otii.create_project():enable_main_power(true)"); err != nil {
+	c, err := client.Dial(address)
+	if err != nil {
 		return err
 	}
-	log.Println("Waiting ten seconds after enabling main power to let device boot up.")
-	time.Sleep(10 * time.Second)
+	log.Println("Connected to Otii server at", address)
+	server = c
 	return nil
 }
 
+// SelectDevice selects the Arc used by the package functions by id, serial
+// or name. The default is the first Arc found.
+func SelectDevice(selector string) {
+	selected = selector
+}
+
+// Devices lists the connected Arcs
+func Devices() ([]Device, error) {
+	if !enabled {
+		return nil, nil
+	}
+	if server != nil {
+		return serverDevices()
+	}
+	out, err := runOutput(`
+		for _, d in ipairs(otii.get_devices("Arc")) do
+			print(d.id .. "\t" .. d.name)
+		end
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var devices []Device
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "\t", 2)
+		if len(fields) == 2 {
+			devices = append(devices, Device{ID: fields[0], Name: fields[1]})
+		}
+	}
+	return devices, nil
+}
+
+// EnableMainPower turns on the power to the device. It returns right away,
+// use the device's WaitForBoot to wait for it to boot.
+func EnableMainPower() error {
+	if !enabled {
+		return nil
+	}
+	log.Println("Enabling main power")
+	if server != nil {
+		return serverSetMainPower(true)
+	}
+	return Run(findDeviceScript + openScript("box", selected) + `
+		box:enable_main_power(true)
+	`)
+}
+
+// DisableMainPower turns off the power to the device
 func DisableMainPower() error {
 	if !enabled {
 		return nil
 	}
-	return Run("otii.create_project():enable_main_power(false)")
+	if server != nil {
+		return serverSetMainPower(false)
+	}
+	return Run(findDeviceScript + openScript("box", selected) + `
+		box:enable_main_power(false)
+	`)
 }
 
 func Calibrate() error {
@@ -45,87 +116,154 @@ func Calibrate() error {
 		return nil
 	}
 	log.Println("Calibrating...")
-	return Run(`
-		local devices = otii.get_devices("Arc")
-		assert(#devices > 0, "No available devices")
-		local box = otii.open_device(devices[1].id)
-		assert(box ~= nil, "No available otii")
+	if server != nil {
+		return serverCalibrate()
+	}
+	return Run(findDeviceScript + openScript("box", selected) + `
 		box:calibrate()
 	`)
 }
 
-func Record(duration time.Duration) error {
+// Record records for duration with the selected Arc configured by m and
+// saves the capture to filename
+func Record(m Measurement, duration time.Duration, filename string) error {
+	return record(m, duration, filename, false)
+}
+
+// RecordPowerOn turns on main power right after the recording has started,
+// to capture a cold boot of the device. Main power should be off before.
+func RecordPowerOn(m Measurement, duration time.Duration, filename string) error {
+	return record(m, duration, filename, true)
+}
+
+func record(m Measurement, duration time.Duration, filename string, powerOn bool) error {
 	if !enabled {
 		return nil
 	}
+	stop := startStop()
+	defer endStop()
+
 	log.Println("Recording started")
-	err := Run(strings.Replace(recordScript, "DURATION", strconv.Itoa(int(duration/time.Millisecond)), -1))
+	if server != nil {
+		err := serverRecord(m, duration, filename, powerOn, stop)
+		log.Println("Recording complete")
+		return err
+	}
+
+	power := ""
+	if powerOn {
+		power = "box:enable_main_power(true)"
+	}
+	wait := fmt.Sprintf("wait(%d)", duration/time.Millisecond)
+	if m.Battery != nil {
+		wait = m.Battery.script("box", duration)
+	}
+	script := strings.NewReplacer(
+		"FIND_DEVICE", findDeviceScript+waitScript(),
+		"OPEN", openScript("box", selected),
+		"CONFIGURE", m.script("box"),
+		"POWERON", power,
+		"WAIT", wait,
+		"FILENAME", strconv.Quote(filename),
+	).Replace(recordScript)
+
+	os.Remove(stopFile())
+	done := make(chan struct{})
+	go watchStopFile(stop, done)
+	err := Run(script)
+	close(done)
+	os.Remove(stopFile())
 	log.Println("Recording complete")
 	return err
 }
 
+// findDeviceScript defines find_device, which picks an Arc by id, serial or
+// name
+const findDeviceScript = `
+local function find_device(selector)
+	local devices = otii.get_devices("Arc")
+	assert(#devices > 0, "No available devices")
+	if selector == "" then
+		return devices[1]
+	end
+	for _, d in ipairs(devices) do
+		if d.id == selector or d.name == selector or string.find(d.id, selector, 1, true) then
+			return d
+		end
+	end
+	error("No device matching " .. selector)
+end
+`
+
+func openScript(box, selector string) string {
+	return fmt.Sprintf(`
+local %[1]s = otii.open_device(find_device(%[2]q).id)
+assert(%[1]s ~= nil, "No available otii")
+`, box, selector)
+}
+
 func Run(script string) error {
+	out, err := runOutput(script)
+	if err != nil {
+		return err
+	}
+	if len(out) > 0 {
+		log.Println("Otii script output:", out)
+	}
+	return nil
+}
+
+// runOutput runs a script and returns its output
+func runOutput(script string) (string, error) {
 	if !enabled {
-		return nil
+		return "", nil
+	}
+	if dryRunDir != "" {
+		return "", writeDryRunScript(script)
 	}
 	f, err := ioutil.TempFile("", "otii-script.lua")
 	if err != nil {
 		log.Println("Error opening temporary file:", err)
-		return err
+		return "", err
 	}
 	defer os.Remove(f.Name())
 
 	if _, err := f.WriteString(script); err != nil {
 		log.Println("Error writing script:", err)
-		return err
+		return "", err
 	}
 	if err := f.Close(); err != nil {
 		log.Println("Error closing script:", err)
-		return err
+		return "", err
 	}
 
 	scriptPath, err := filepath.Abs(f.Name())
 	if err != nil {
 		log.Println("Error abs path:", err)
-		return err
+		return "", err
 	}
-	out, err := exec.Command("/Applications/otii.app/Contents/MacOS/otiicli", "--no-banner", scriptPath).CombinedOutput()
+	cmd := exec.Command(cliPath, "--no-banner", scriptPath)
+	detach(cmd)
+	out, err := cmd.CombinedOutput()
 	if err != nil {
 		log.Printf("Error running otii script: %v\n%s", err, out)
-		return err
+		return "", err
 	}
-
-	if len(out) > 0 {
-		log.Println("Otii script output:", string(out))
-	}
-	return nil
+	return string(out), nil
 }
 
 const recordScript = `
 local project = otii.create_project()
 assert(project ~= nil, "Cannot create project")
 
-local devices = otii.get_devices("Arc")
-assert(#devices > 0, "No available devices")
-local box = otii.open_device(devices[1].id)
-assert(box ~= nil, "No available otii")
-
-box:set_main_voltage(3.3)
-box:set_range("high")
-box:set_max_current(0.5)
-box:enable_channel("mc", true)
-box:enable_channel("mv", true)
-
-// box:set_adc_resistor(10)
-// box:enable_channel("ac", true)
-// box:enable_channel("av", true)
-
+FIND_DEVICE
+OPEN
+CONFIGURE
 project:start()
-otii.msleep(DURATION)
+POWERON
+WAIT
 project:stop()
 
-local filename = string.format("captures/capture_%s.otii", os.date("%Y-%m-%dT%H:%M:%S"))
-project:save(filename)
+project:save(FILENAME)
 project:close()
-box:close()
-`
+box:close()`
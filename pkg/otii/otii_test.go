@@ -0,0 +1,68 @@
+package otii
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dryRun runs f with the scripts written to a temporary directory, and
+// returns the scripts in the order they were written
+func dryRun(t *testing.T, f func() error) []string {
+	t.Helper()
+	dir := t.TempDir()
+	Init(true)
+	defer Init(false)
+	if err := SetDryRun(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDryRun("")
+	if err := f(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.lua"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scripts []string
+	for _, filename := range files {
+		if strings.ContainsAny(filepath.Base(filename), `<>:"|?*`) {
+			t.Errorf("script filename %s isn't valid on Windows", filepath.Base(filename))
+		}
+		buf, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scripts = append(scripts, string(buf))
+	}
+	return scripts
+}
+
+func TestSelectedArc(t *testing.T) {
+	SelectDevice("Arc 2")
+	defer SelectDevice("")
+	tests := []struct {
+		name string
+		f    func() error
+		want string
+	}{
+		{"enable", EnableMainPower, "box:enable_main_power(true)"},
+		{"disable", DisableMainPower, "box:enable_main_power(false)"},
+		{"calibrate", Calibrate, "box:calibrate()"},
+		{"record", func() error { return Record(DefaultMeasurement, time.Second, "capture.otii") }, "wait(1000)"},
+		{"power on", func() error { return RecordPowerOn(DefaultMeasurement, time.Second, "capture.otii") }, "box:enable_main_power(true)"},
+	}
+	for _, tt := range tests {
+		scripts := dryRun(t, tt.f)
+		if len(scripts) != 1 {
+			t.Errorf("%s: %d scripts, want 1", tt.name, len(scripts))
+			continue
+		}
+		script := scripts[0]
+		if !strings.Contains(script, `otii.open_device(find_device("Arc 2").id)`) || !strings.Contains(script, tt.want) {
+			t.Errorf("%s: script doesn't open the selected Arc or lacks %s:\n%s", tt.name, tt.want, script)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package otii
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach starts cmd in its own process group, so that a Ctrl-C in the
+// terminal doesn't kill otiicli before the recording is stopped and saved
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
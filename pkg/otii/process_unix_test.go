@@ -0,0 +1,113 @@
+//go:build !windows
+// +build !windows
+
+package otii
+
+import (
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeCLIEnv makes the test binary act as otiicli, see fakeCLI
+const fakeCLIEnv = "OTII_FAKE_CLI"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeCLIEnv) != "" {
+		os.Exit(fakeCLI(os.Args[len(os.Args)-1]))
+	}
+	os.Exit(m.Run())
+}
+
+var (
+	stopFilePattern = regexp.MustCompile(`io\.open\(("[^"]*"), "r"\)`)
+	savePattern     = regexp.MustCompile(`project:save\(("[^"]*")\)`)
+)
+
+// fakeCLI runs a recording script like otiicli: it marks the capture as
+// running, waits for the stop file and saves the capture
+func fakeCLI(script string) int {
+	buf, err := ioutil.ReadFile(script)
+	if err != nil {
+		return 1
+	}
+	stop, err1 := strconv.Unquote(stopFilePattern.FindStringSubmatch(string(buf))[1])
+	capture, err2 := strconv.Unquote(savePattern.FindStringSubmatch(string(buf))[1])
+	if err1 != nil || err2 != nil {
+		return 1
+	}
+	ioutil.WriteFile(capture+".running", nil, 0644)
+	for start := time.Now(); time.Since(start) < 10*time.Second; {
+		if _, err := os.Stat(stop); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := ioutil.WriteFile(capture, []byte("capture"), 0644); err != nil {
+		return 1
+	}
+	return 0
+}
+
+func TestRecordInterrupted(t *testing.T) {
+	// The test runs in its own process group, which it interrupts like a
+	// Ctrl-C in the terminal would
+	pgid, err := syscall.Getpgid(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Setpgid(0, 0); err != nil {
+		t.Skip("can't create a process group:", err)
+	}
+	defer syscall.Setpgid(0, pgid)
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	os.Setenv(fakeCLIEnv, "1")
+	defer os.Unsetenv(fakeCLIEnv)
+	defer func(path string) { cliPath = path }(cliPath)
+	cliPath = os.Args[0]
+	Init(true)
+	defer Init(false)
+
+	capture := filepath.Join(t.TempDir(), "capture.otii")
+	done := make(chan error, 1)
+	go func() {
+		done <- Record(DefaultMeasurement, time.Minute, capture)
+	}()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(capture + ".running"); err == nil {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("otiicli didn't start")
+		}
+	}
+
+	if err := syscall.Kill(-os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	<-interrupts
+	// Give an otiicli in the same process group time to die
+	time.Sleep(200 * time.Millisecond)
+	Stop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Record() = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("recording didn't stop")
+	}
+	if _, err := os.Stat(capture); err != nil {
+		t.Errorf("capture not saved: %v", err)
+	}
+}
@@ -0,0 +1,12 @@
+package otii
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach starts cmd in its own process group, so that a Ctrl-C in the
+// console doesn't kill otiicli before the recording is stopped and saved
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
@@ -0,0 +1,158 @@
+package otii
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/otii/client"
+)
+
+func serverArcs() ([]client.Device, error) {
+	devices, err := server.Devices(3 * time.Second)
+	if err != nil {
+		return nil, err
+	}
+	var arcs []client.Device
+	for _, d := range devices {
+		if d.Type == "Arc" {
+			arcs = append(arcs, d)
+		}
+	}
+	return arcs, nil
+}
+
+// arc returns the id of the Arc matching selector, or the first Arc
+// connected to the server when selector is empty, like the Lua scripts do
+func arc(selector string) (string, error) {
+	arcs, err := serverArcs()
+	if err != nil {
+		return "", err
+	}
+	if len(arcs) == 0 {
+		return "", errors.New("no available devices")
+	}
+	if selector == "" {
+		return arcs[0].ID, nil
+	}
+	for _, d := range arcs {
+		if d.ID == selector || d.Name == selector || d.Serial == selector || strings.Contains(d.ID, selector) {
+			return d.ID, nil
+		}
+	}
+	return "", errors.New("no device matching " + selector)
+}
+
+func serverDevices() ([]Device, error) {
+	arcs, err := serverArcs()
+	if err != nil {
+		return nil, err
+	}
+	var devices []Device
+	for _, d := range arcs {
+		devices = append(devices, Device{ID: d.ID, Name: d.Name})
+	}
+	return devices, nil
+}
+
+func serverSetMainPower(enable bool) error {
+	id, err := arc(selected)
+	if err != nil {
+		return err
+	}
+	return server.SetMainPower(id, enable)
+}
+
+func serverCalibrate() error {
+	id, err := arc(selected)
+	if err != nil {
+		return err
+	}
+	return server.Calibrate(id)
+}
+
+func serverRecord(m Measurement, duration time.Duration, filename string, powerOn bool, stop <-chan struct{}) error {
+	id, err := arc(selected)
+	if err != nil {
+		return err
+	}
+	project, err := server.CreateProject()
+	if err != nil {
+		return err
+	}
+	defer server.CloseProject(project)
+
+	if err := serverConfigure(id, m); err != nil {
+		log.Println("Error configuring recording:", err)
+		return err
+	}
+	if err := server.StartRecording(project); err != nil {
+		return err
+	}
+	if powerOn {
+		if err := server.SetMainPower(id, true); err != nil {
+			return err
+		}
+	}
+	if m.Battery != nil {
+		err = serverBattery(id, *m.Battery, duration, stop)
+	} else {
+		sleep(duration, stop)
+	}
+	if err != nil {
+		server.StopRecording(project)
+		return err
+	}
+	if err := server.StopRecording(project); err != nil {
+		return err
+	}
+
+	// The server resolves relative paths against its own working directory
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	return server.SaveProject(project, path)
+}
+
+func serverConfigure(id string, m Measurement) error {
+	steps := []func() error{
+		func() error { return server.SetMainVoltage(id, m.MainVoltage) },
+		func() error { return server.SetRange(id, m.Range) },
+		func() error { return server.SetMaxCurrent(id, m.MaxCurrent) },
+	}
+	if m.ADCResistor > 0 {
+		steps = append(steps, func() error { return server.SetADCResistor(id, m.ADCResistor) })
+	}
+	if m.SampleRate > 0 {
+		steps = append(steps, func() error { return server.SetSampleRate(id, m.SampleRate) })
+	}
+	for _, ch := range m.Channels {
+		ch := ch
+		steps = append(steps, func() error { return server.EnableChannel(id, ch, true) })
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func serverBattery(id string, battery BatteryProfile, duration time.Duration, stop <-chan struct{}) error {
+	if !sleep(battery.start(duration), stop) {
+		return nil
+	}
+	for _, step := range battery.steps(duration) {
+		if err := server.SetMainVoltage(id, step.voltage); err != nil {
+			log.Println("Error setting battery voltage:", err)
+			return err
+		}
+		if !sleep(step.hold, stop) {
+			return nil
+		}
+	}
+	return nil
+}
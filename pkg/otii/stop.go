@@ -0,0 +1,90 @@
+package otii
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	stopMutex sync.Mutex
+	// stopping is closed by Stop while a recording is running
+	stopping chan struct{}
+)
+
+// Stop ends a running recording early, e.g. when the test is interrupted.
+// The capture recorded so far is saved as usual.
+func Stop() {
+	stopMutex.Lock()
+	defer stopMutex.Unlock()
+	if stopping != nil {
+		close(stopping)
+		stopping = nil
+	}
+}
+
+// startStop returns the channel closed by Stop during a recording
+func startStop() <-chan struct{} {
+	stopMutex.Lock()
+	defer stopMutex.Unlock()
+	stopping = make(chan struct{})
+	return stopping
+}
+
+func endStop() {
+	stopMutex.Lock()
+	defer stopMutex.Unlock()
+	stopping = nil
+}
+
+// sleep waits for d or until stop is closed, and returns false if stopped
+func sleep(d time.Duration, stop <-chan struct{}) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// stopFile is the file otiicli scripts look for to end a recording early,
+// since the script can't be signalled while it runs
+func stopFile() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("otii-stop-%d", os.Getpid()))
+}
+
+// watchStopFile creates the stop file when stop is closed, until done is
+// closed
+func watchStopFile(stop <-chan struct{}, done <-chan struct{}) {
+	select {
+	case <-stop:
+		ioutil.WriteFile(stopFile(), nil, 0644)
+	case <-done:
+	}
+}
+
+// waitScript defines wait, which sleeps unless the stop file exists and sets
+// stopped when it does
+func waitScript() string {
+	return fmt.Sprintf(`
+local stopped = false
+local function wait(ms)
+	while ms > 0 and not stopped do
+		local f = io.open(%q, "r")
+		if f ~= nil then
+			f:close()
+			stopped = true
+		else
+			local step = math.min(ms, 100)
+			otii.msleep(step)
+			ms = ms - step
+		end
+	end
+end
+`, stopFile())
+}
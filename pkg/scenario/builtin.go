@@ -0,0 +1,165 @@
+package scenario
+
+import (
+	"sort"
+	"time"
+)
+
+// psm is the PSM configuration of the original test flow, a TAU of 31*320
+// hours and an active time of 2 seconds
+var psm = &PSM{Enabled: true, TAU: 223, ActiveTime: 1}
+
+func seconds(s int) Duration {
+	return Duration{time.Duration(s) * time.Second}
+}
+
+// Builtin are the scenarios selectable by name
+var Builtin = map[string]Scenario{
+	// send is the original test flow: reboot and configure the module with
+	// PSM, wait for registration, let it settle and send three small packets
+	// while recording, each on a new socket
+	"send": {
+		Name:        "send",
+		Description: "Send three small UDP packets with release after the message",
+		Steps: []Step{
+			{Type: Configure, Reboot: true, PSM: psm, DisableEDRX: true},
+			{Type: WaitForRegistration},
+			{Type: Sleep, Name: "settle", Duration: seconds(30)},
+			{Type: Record, Duration: seconds(30), Steps: []Step{
+				{Type: Sleep, Duration: seconds(5)},
+				{Type: Send, Count: 3, Interval: seconds(5)},
+			}},
+		},
+	},
+	"sendreceive": {
+		Name:        "sendreceive",
+		Description: "Send three small UDP packets and receive the echoes, with release after the reply",
+		Steps: []Step{
+			{Type: Configure, Reboot: true, PSM: psm, DisableEDRX: true},
+			{Type: WaitForRegistration},
+			{Type: Sleep, Name: "settle", Duration: seconds(30)},
+			{Type: Record, Duration: seconds(30), Steps: []Step{
+				{Type: Sleep, Duration: seconds(5)},
+				{Type: SendAndReceive, Count: 3, Interval: seconds(5)},
+			}},
+		},
+	},
+	"send-resolve": {
+		Name:        "send-resolve",
+		Description: "Resolve the server hostname and send three small UDP packets on one socket",
+		Steps: []Step{
+			{Type: Configure, Reboot: true, PSM: psm, DisableEDRX: true},
+			{Type: WaitForRegistration},
+			{Type: Sleep, Name: "settle", Duration: seconds(30)},
+			{Type: Record, Duration: seconds(30), Steps: []Step{
+				{Type: Sleep, Duration: seconds(5)},
+				// The DNS lookup is a separate phase so that its cost can be
+				// told apart from the packets in the capture
+				{Type: Resolve},
+				{Type: Sleep, Duration: seconds(5)},
+				{Type: Send, Count: 3, Interval: seconds(5), SharedSocket: true},
+			}},
+		},
+	},
+	"sendreceive-resolve": {
+		Name:        "sendreceive-resolve",
+		Description: "Resolve the server hostname, send three small UDP packets on one socket and receive the echoes",
+		Steps: []Step{
+			{Type: Configure, Reboot: true, PSM: psm, DisableEDRX: true},
+			{Type: WaitForRegistration},
+			{Type: Sleep, Name: "settle", Duration: seconds(30)},
+			{Type: Record, Duration: seconds(30), Steps: []Step{
+				{Type: Sleep, Duration: seconds(5)},
+				{Type: Resolve},
+				{Type: Sleep, Duration: seconds(5)},
+				{Type: SendAndReceive, Count: 3, Interval: seconds(5), SharedSocket: true},
+			}},
+		},
+	},
+	"attach-only": {
+		Name:        "attach-only",
+		Description: "Record the network attach after a reboot",
+		Steps: []Step{
+			{Type: Configure, Reboot: true, PSM: psm, DisableEDRX: true},
+			{Type: Record, Duration: seconds(60), Steps: []Step{
+				{Type: WaitForRegistration, Duration: seconds(50)},
+			}},
+		},
+	},
+	"psm-sleep-floor": {
+		Name:        "psm-sleep-floor",
+		Description: "Record a minute of PSM sleep to measure the floor current",
+		Steps: []Step{
+			{Type: Configure, Reboot: true, PSM: psm, DisableEDRX: true},
+			{Type: WaitForRegistration},
+			// Let the active timer expire and the RRC connection be released
+			{Type: Sleep, Name: "enter psm", Duration: seconds(60)},
+			{Type: Record, Duration: seconds(60), Steps: []Step{
+				{Type: Sleep, Duration: seconds(55)},
+			}},
+		},
+	},
+	"periodic-tau": {
+		Name:        "periodic-tau",
+		Description: "Record PSM sleep with a 2 minute TAU to capture the periodic tracking area updates",
+		Steps: []Step{
+			// TAU of 2*1 minute and active time of 2 seconds
+			{Type: Configure, Reboot: true, PSM: &PSM{Enabled: true, TAU: 0xa2, ActiveTime: 1}, DisableEDRX: true},
+			{Type: WaitForRegistration},
+			{Type: Sleep, Name: "enter psm", Duration: seconds(30)},
+			{Type: Record, Duration: seconds(300), Steps: []Step{
+				{Type: Sleep, Duration: seconds(295)},
+			}},
+		},
+	},
+	"tcp-send": {
+		Name:        "tcp-send",
+		Description: "Send three small packets over TCP",
+		Steps: []Step{
+			{Type: Configure, Reboot: true, PSM: psm, DisableEDRX: true},
+			{Type: WaitForRegistration},
+			{Type: Sleep, Name: "settle", Duration: seconds(30)},
+			{Type: Record, Duration: seconds(30), Steps: []Step{
+				{Type: Sleep, Duration: seconds(5)},
+				{Type: Resolve},
+				{Type: Sleep, Duration: seconds(5)},
+				{Type: Send, Protocol: "tcp", Count: 3, Interval: seconds(5), SharedSocket: true},
+			}},
+		},
+	},
+	"burst": {
+		Name:        "burst",
+		Description: "Send ten UDP packets back to back in one connection",
+		Steps: []Step{
+			{Type: Configure, Reboot: true, PSM: psm, DisableEDRX: true},
+			{Type: WaitForRegistration},
+			{Type: Sleep, Name: "settle", Duration: seconds(30)},
+			{Type: Record, Duration: seconds(30), Steps: []Step{
+				{Type: Sleep, Duration: seconds(5)},
+				{Type: Resolve},
+				{Type: Sleep, Duration: seconds(5)},
+				// The connection is released after the last packet only
+				{Type: Send, Name: "burst", Count: 10, Size: 64, Flag: "none", LastFlag: "release-after-message", SharedSocket: true},
+			}},
+		},
+	},
+}
+
+// Names returns the names of the built-in scenarios in alphabetical order
+func Names() []string {
+	var names []string
+	for name := range Builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Find returns the built-in scenario called name, or loads it from a JSON
+// file if there is no such scenario
+func Find(name string) (Scenario, error) {
+	if s, ok := Builtin[name]; ok {
+		return s, nil
+	}
+	return Load(name)
+}
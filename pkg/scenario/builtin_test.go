@@ -0,0 +1,46 @@
+package scenario
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestBuiltin(t *testing.T) {
+	for name, s := range Builtin {
+		if s.Name != name {
+			t.Errorf("%s: named %s", name, s.Name)
+		}
+		if err := s.Validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	// The original test flow sends each packet on a new socket
+	for _, name := range []string{"send", "sendreceive"} {
+		for _, step := range Builtin[name].Steps {
+			for _, s := range step.Steps {
+				if s.Type == Resolve || s.SharedSocket {
+					t.Errorf("%s: %s step differs from the original flow", name, s.Title())
+				}
+			}
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	names := Names()
+	if len(names) != len(Builtin) || !sort.StringsAreSorted(names) {
+		t.Errorf("Names() = %v", names)
+	}
+}
+
+func TestFind(t *testing.T) {
+	for _, name := range Names() {
+		s, err := Find(name)
+		if err != nil || s.Name != name {
+			t.Errorf("Find(%s) = %s, %v", name, s.Name, err)
+		}
+	}
+	if _, err := Find("no-such-scenario"); err == nil {
+		t.Error("Find() of an unknown scenario succeeded")
+	}
+}
@@ -0,0 +1,166 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Actions are the operations the steps are made of. They're implemented by
+// the tester, which owns the device and the Otii.
+type Actions interface {
+	Configure(step Step) error
+	WaitForRegistration(ctx context.Context, timeout time.Duration) error
+	// StartRecording starts a recording of duration and returns a function
+	// waiting for it to complete. The recording should be stopped early and
+	// saved if ctx is cancelled.
+	StartRecording(ctx context.Context, duration time.Duration) (wait func() error, err error)
+	Resolve() error
+	// OpenSocket opens the socket the next packets of a send step are sent
+	// on, and CloseSocket closes it
+	OpenSocket(step Step) error
+	CloseSocket()
+	// Send and SendAndReceive send one packet
+	Send(step Step) error
+	SendAndReceive(step Step) error
+	// Mark is called at each phase boundary, e.g. for a sync pulse
+	Mark(label string)
+	Metric(name string) (float64, error)
+}
+
+// StepResult is the outcome of a step
+type StepResult struct {
+	Step     Step
+	Start    time.Time
+	Duration time.Duration
+	// Err is nil if the step passed
+	Err error
+}
+
+// Runner runs scenarios
+type Runner struct {
+	Actions Actions
+	// Results are the results of the steps run so far, in the order they
+	// completed. A record step completes after its steps.
+	Results []StepResult
+}
+
+// Run runs the steps of s until one fails or ctx is cancelled. A cancelled
+// run returns ctx.Err().
+func (r *Runner) Run(ctx context.Context, s Scenario) error {
+	log.Printf("Running scenario %s", s.Name)
+	return r.runSteps(ctx, s.Steps)
+}
+
+func (r *Runner) runSteps(ctx context.Context, steps []Step) error {
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		start := time.Now()
+		err := r.runStep(ctx, step)
+		r.Results = append(r.Results, StepResult{Step: step, Start: start, Duration: time.Since(start), Err: err})
+		if err != nil {
+			log.Printf("Step %s failed: %v", step.Title(), err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) runStep(ctx context.Context, step Step) error {
+	log.Printf("Step %s", step.Title())
+	switch step.Type {
+	case Configure:
+		return r.Actions.Configure(step)
+	case WaitForRegistration:
+		return r.Actions.WaitForRegistration(ctx, step.Duration.Duration)
+	case Record:
+		wait, err := r.Actions.StartRecording(ctx, step.Duration.Duration)
+		if err != nil {
+			return err
+		}
+		// The recording is completed even if a step fails, so the capture
+		// of the failure is kept
+		stepErr := r.runSteps(ctx, step.Steps)
+		if err := wait(); err != nil {
+			return err
+		}
+		return stepErr
+	case Resolve:
+		r.Actions.Mark(step.Title())
+		return r.Actions.Resolve()
+	case Send, SendAndReceive:
+		if step.SharedSocket {
+			if err := r.Actions.OpenSocket(step); err != nil {
+				r.Actions.CloseSocket()
+				return err
+			}
+			defer r.Actions.CloseSocket()
+		}
+		for i := 0; i < step.Packets(); i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			r.Actions.Mark(fmt.Sprintf("%s %d", step.Title(), i+1))
+			packet := step
+			if i == step.Packets()-1 && step.LastFlag != "" {
+				packet.Flag = step.LastFlag
+			}
+			if err := r.sendPacket(packet); err != nil {
+				return err
+			}
+			if err := SleepContext(ctx, step.Interval.Duration); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Sleep:
+		r.Actions.Mark(step.Title())
+		return SleepContext(ctx, step.Duration.Duration)
+	case Assert:
+		v, err := r.Actions.Metric(step.Metric)
+		if err != nil {
+			return err
+		}
+		if step.Min != nil && v < *step.Min {
+			return fmt.Errorf("%s is %g, below %g", step.Metric, v, *step.Min)
+		}
+		if step.Max != nil && v > *step.Max {
+			return fmt.Errorf("%s is %g, above %g", step.Metric, v, *step.Max)
+		}
+		log.Printf("%s is %g", step.Metric, v)
+		return nil
+	}
+	return fmt.Errorf("unknown step type %q", step.Type)
+}
+
+// sendPacket sends one packet of a send step, on a socket of its own unless
+// the step shares one
+func (r *Runner) sendPacket(step Step) error {
+	if !step.SharedSocket {
+		if err := r.Actions.OpenSocket(step); err != nil {
+			r.Actions.CloseSocket()
+			return err
+		}
+		defer r.Actions.CloseSocket()
+	}
+	if step.Type == Send {
+		return r.Actions.Send(step)
+	}
+	return r.Actions.SendAndReceive(step)
+}
+
+// SleepContext waits for d or until ctx is cancelled, and returns ctx.Err()
+// if it was
+func SleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
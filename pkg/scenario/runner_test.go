@@ -0,0 +1,209 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeActions records the actions as strings, and fails the action named by
+// fail
+type fakeActions struct {
+	calls   []string
+	fail    string
+	metrics map[string]float64
+	cancel  func()
+}
+
+func (f *fakeActions) call(name string) error {
+	f.calls = append(f.calls, name)
+	if name == f.fail {
+		return errors.New(name + " failed")
+	}
+	if f.cancel != nil && strings.HasPrefix(name, "send") {
+		f.cancel()
+	}
+	return nil
+}
+
+func (f *fakeActions) Configure(step Step) error {
+	return f.call("configure")
+}
+
+func (f *fakeActions) WaitForRegistration(ctx context.Context, timeout time.Duration) error {
+	return f.call("wait")
+}
+
+func (f *fakeActions) StartRecording(ctx context.Context, duration time.Duration) (func() error, error) {
+	if err := f.call("record"); err != nil {
+		return nil, err
+	}
+	return func() error { return f.call("stop") }, nil
+}
+
+func (f *fakeActions) Resolve() error {
+	return f.call("resolve")
+}
+
+func (f *fakeActions) OpenSocket(step Step) error {
+	return f.call("open")
+}
+
+func (f *fakeActions) CloseSocket() {
+	f.call("close")
+}
+
+func (f *fakeActions) Send(step Step) error {
+	return f.call("send " + step.Flag)
+}
+
+func (f *fakeActions) SendAndReceive(step Step) error {
+	return f.call("echo")
+}
+
+func (f *fakeActions) Mark(label string) {
+	f.calls = append(f.calls, "mark "+label)
+}
+
+func (f *fakeActions) Metric(name string) (float64, error) {
+	v, ok := f.metrics[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown metric %q", name)
+	}
+	return v, nil
+}
+
+var runnerScenario = Scenario{Name: "test", Steps: []Step{
+	{Type: Configure},
+	{Type: WaitForRegistration},
+	{Type: Record, Duration: seconds(1), Steps: []Step{
+		{Type: Resolve},
+		{Type: Send, Count: 2, Flag: "none", LastFlag: "release-after-message"},
+	}},
+	{Type: Assert, Metric: "energy_j", Max: float(1)},
+}}
+
+func TestRun(t *testing.T) {
+	f := &fakeActions{metrics: map[string]float64{"energy_j": 0.5}}
+	r := Runner{Actions: f}
+	if err := r.Run(context.Background(), runnerScenario); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"configure", "wait", "record",
+		"mark resolve", "resolve",
+		"mark send 1", "open", "send none", "close",
+		"mark send 2", "open", "send release-after-message", "close",
+		"stop",
+	}
+	if !reflect.DeepEqual(f.calls, want) {
+		t.Errorf("calls = %v, want %v", f.calls, want)
+	}
+	// The record step completes after its steps
+	var types []string
+	for _, res := range r.Results {
+		types = append(types, res.Step.Type)
+		if res.Err != nil {
+			t.Errorf("%s: %v", res.Step.Type, res.Err)
+		}
+	}
+	if want := []string{Configure, WaitForRegistration, Resolve, Send, Record, Assert}; !reflect.DeepEqual(types, want) {
+		t.Errorf("results = %v, want %v", types, want)
+	}
+}
+
+func TestRunFailure(t *testing.T) {
+	tests := []struct {
+		fail  string
+		calls []string
+	}{
+		// The recording is completed and the socket closed when a step fails
+		{"send none", []string{"configure", "wait", "record", "mark resolve", "resolve", "mark send 1", "open", "send none", "close", "stop"}},
+		{"open", []string{"configure", "wait", "record", "mark resolve", "resolve", "mark send 1", "open", "close", "stop"}},
+		{"wait", []string{"configure", "wait"}},
+	}
+	for _, tt := range tests {
+		f := &fakeActions{fail: tt.fail}
+		r := Runner{Actions: f}
+		err := r.Run(context.Background(), runnerScenario)
+		if err == nil || !strings.Contains(err.Error(), tt.fail) {
+			t.Errorf("%s: error %v", tt.fail, err)
+		}
+		if !reflect.DeepEqual(f.calls, tt.calls) {
+			t.Errorf("%s: calls = %v, want %v", tt.fail, f.calls, tt.calls)
+		}
+		if last := r.Results[len(r.Results)-1]; last.Err == nil {
+			t.Errorf("%s: last result %s passed", tt.fail, last.Step.Type)
+		}
+	}
+}
+
+func TestRunSharedSocket(t *testing.T) {
+	tests := []struct {
+		fail  string
+		calls []string
+	}{
+		{"", []string{"open", "mark send 1", "echo", "mark send 2", "echo", "close"}},
+		{"echo", []string{"open", "mark send 1", "echo", "close"}},
+		{"open", []string{"open", "close"}},
+	}
+	for _, tt := range tests {
+		f := &fakeActions{fail: tt.fail}
+		r := Runner{Actions: f}
+		r.Run(context.Background(), Scenario{Name: "shared", Steps: []Step{{Type: SendAndReceive, Name: "send", Count: 2, SharedSocket: true}}})
+		if !reflect.DeepEqual(f.calls, tt.calls) {
+			t.Errorf("%q: calls = %v, want %v", tt.fail, f.calls, tt.calls)
+		}
+	}
+}
+
+func TestRunAssert(t *testing.T) {
+	tests := []struct {
+		value float64
+		min   *float64
+		max   *float64
+		ok    bool
+	}{
+		{0.5, nil, float(1), true},
+		{1.5, nil, float(1), false},
+		{0.5, float(0.1), nil, true},
+		{0.05, float(0.1), float(1), false},
+	}
+	for _, tt := range tests {
+		f := &fakeActions{metrics: map[string]float64{"energy_j": tt.value}}
+		r := Runner{Actions: f}
+		err := r.Run(context.Background(), Scenario{Name: "assert", Steps: []Step{{Type: Assert, Metric: "energy_j", Min: tt.min, Max: tt.max}}})
+		if (err == nil) != tt.ok {
+			t.Errorf("%g: error %v", tt.value, err)
+		}
+	}
+	r := Runner{Actions: &fakeActions{}}
+	if err := r.Run(context.Background(), Scenario{Name: "assert", Steps: []Step{{Type: Assert, Metric: "x", Max: float(1)}}}); err == nil {
+		t.Error("unknown metric passed")
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f := &fakeActions{cancel: cancel}
+	r := Runner{Actions: f}
+	s := Scenario{Name: "cancel", Steps: []Step{
+		{Type: Send, Count: 3, Interval: seconds(60)},
+		{Type: Sleep, Duration: seconds(60)},
+	}}
+	start := time.Now()
+	if err := r.Run(ctx, s); err != context.Canceled {
+		t.Errorf("Run() = %v, want %v", err, context.Canceled)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Error("cancelled run didn't stop")
+	}
+	if want := []string{"mark send 1", "open", "send ", "close"}; !reflect.DeepEqual(f.calls, want) {
+		t.Errorf("calls = %v, want %v", f.calls, want)
+	}
+}
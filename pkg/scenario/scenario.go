@@ -0,0 +1,309 @@
+package scenario
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/devicefamily"
+)
+
+// Step types
+const (
+	// Configure reboots and configures the module
+	Configure = "configure"
+	// WaitForRegistration waits until the module is registered, at most
+	// Duration if set
+	WaitForRegistration = "wait-for-registration"
+	// Record records with the Otii for Duration while running Steps
+	Record = "record"
+	// Resolve resolves the server hostname
+	Resolve = "resolve"
+	// Send sends Count packets to the server, Interval apart
+	Send = "send"
+	// SendAndReceive sends Count packets and waits for the echo of each
+	SendAndReceive = "send-and-receive"
+	// Sleep waits for Duration
+	Sleep = "sleep"
+	// Assert checks that Metric is between Min and Max
+	Assert = "assert"
+)
+
+// Scenario is a test flow
+type Scenario struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Steps       []Step `json:"steps"`
+}
+
+// Step is one step of a scenario. Which parameters apply depends on the type.
+type Step struct {
+	Type string `json:"type"`
+	// Name describes the step in the results, the type is used if empty
+	Name     string   `json:"name,omitempty"`
+	Duration Duration `json:"duration,omitempty"`
+	// Steps are run while recording
+	Steps []Step `json:"steps,omitempty"`
+
+	// Reboot reboots the module and sets the radio, APN and operator before
+	// configuring
+	Reboot      bool `json:"reboot,omitempty"`
+	PSM         *PSM `json:"psm,omitempty"`
+	DisableEDRX bool `json:"disable_edrx,omitempty"`
+	// EDRX is applied after DisableEDRX
+	EDRX *EDRX `json:"edrx,omitempty"`
+	// Radio sets the radio functionality last, e.g. "airplane" to measure
+	// its floor current, see devicefamily.ParseRadio
+	Radio string `json:"radio,omitempty"`
+
+	// Protocol is "udp" or "tcp" for send steps, default udp
+	Protocol string   `json:"protocol,omitempty"`
+	Count    int      `json:"count,omitempty"`
+	Interval Duration `json:"interval,omitempty"`
+	// Size is the payload size in bytes, default 2
+	Size int `json:"size,omitempty"`
+	// Flag is the send flag, see ParseSendFlag
+	Flag string `json:"flag,omitempty"`
+	// LastFlag is the send flag of the last packet, default Flag
+	LastFlag string `json:"last_flag,omitempty"`
+	// SharedSocket sends all the packets on one socket, e.g. to send a
+	// burst in one connection. By default each packet is sent on a new
+	// socket like the original test flow.
+	SharedSocket bool `json:"shared_socket,omitempty"`
+
+	// Metric is the name of a result metric, e.g. energy_j
+	Metric string   `json:"metric,omitempty"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+}
+
+// PSM is the power saving mode configuration. The timers are the encoded
+// 3GPP timer values.
+type PSM struct {
+	Enabled    bool  `json:"enabled"`
+	TAU        uint8 `json:"tau"`
+	ActiveTime uint8 `json:"active_time"`
+}
+
+// EDRX is the eDRX configuration. The cycle is the encoded 4 bit cycle
+// length, e.g. 5 for 81.92 seconds.
+type EDRX struct {
+	Enabled bool  `json:"enabled"`
+	Cycle   uint8 `json:"cycle,omitempty"`
+}
+
+// Duration is a time.Duration written as a string in JSON, e.g. "30s"
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// Load reads a scenario from a JSON file
+func Load(filename string) (Scenario, error) {
+	var s Scenario
+	f, err := os.Open(filename)
+	if err != nil {
+		return s, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return s, err
+	}
+	return s, s.Validate()
+}
+
+// Validate checks the steps and their parameters
+func (s Scenario) Validate() error {
+	if s.Name == "" {
+		return errors.New("scenario has no name")
+	}
+	if len(s.Steps) == 0 {
+		return errors.New("scenario has no steps")
+	}
+	return validateSteps(s.Steps, false)
+}
+
+func validateSteps(steps []Step, recording bool) error {
+	for i, step := range steps {
+		if err := step.validate(recording); err != nil {
+			return fmt.Errorf("step %d (%s): %v", i+1, step.Title(), err)
+		}
+	}
+	return nil
+}
+
+func (s Step) validate(recording bool) error {
+	switch s.Type {
+	case Configure:
+		if s.EDRX != nil && s.EDRX.Cycle > 0x0f {
+			return errors.New("eDRX cycle must be 4 bits")
+		}
+		if s.Radio != "" {
+			if _, err := devicefamily.ParseRadio(s.Radio); err != nil {
+				return err
+			}
+		}
+	case WaitForRegistration, Resolve:
+	case Record:
+		if recording {
+			return errors.New("recordings can't be nested")
+		}
+		if s.Duration.Duration <= 0 {
+			return errors.New("missing duration")
+		}
+		return validateSteps(s.Steps, true)
+	case Send, SendAndReceive:
+		if s.Protocol != "" && s.Protocol != "udp" && !(s.Protocol == "tcp" && s.Type == Send) {
+			return fmt.Errorf("unsupported protocol %q", s.Protocol)
+		}
+		if s.Count < 0 || s.Size < 0 || s.Interval.Duration < 0 {
+			return errors.New("negative count, size or interval")
+		}
+		for _, flag := range []string{s.Flag, s.LastFlag} {
+			if flag == "" {
+				continue
+			}
+			if _, err := ParseSendFlag(flag); err != nil {
+				return err
+			}
+		}
+	case Sleep:
+		if s.Duration.Duration <= 0 {
+			return errors.New("missing duration")
+		}
+	case Assert:
+		if s.Metric == "" {
+			return errors.New("missing metric")
+		}
+		if s.Min == nil && s.Max == nil {
+			return errors.New("missing min or max")
+		}
+	default:
+		return fmt.Errorf("unknown step type %q", s.Type)
+	}
+	return nil
+}
+
+// WithoutReboot returns a copy of s where the configure steps don't reboot
+// the module, e.g. for repeated runs on a module that's already set up
+func (s Scenario) WithoutReboot() Scenario {
+	s.Steps = withoutReboot(s.Steps)
+	return s
+}
+
+func withoutReboot(steps []Step) []Step {
+	if steps == nil {
+		return nil
+	}
+	copied := make([]Step, len(steps))
+	for i, step := range steps {
+		step.Reboot = false
+		step.Steps = withoutReboot(step.Steps)
+		copied[i] = step
+	}
+	return copied
+}
+
+// Protocols returns the protocols of the send steps, e.g. ["udp", "tcp"]
+func (s Scenario) Protocols() []string {
+	seen := make(map[string]bool)
+	var protocols []string
+	var visit func(steps []Step)
+	visit = func(steps []Step) {
+		for _, step := range steps {
+			if step.Type == Send || step.Type == SendAndReceive {
+				protocol := step.Protocol
+				if protocol == "" {
+					protocol = "udp"
+				}
+				if !seen[protocol] {
+					seen[protocol] = true
+					protocols = append(protocols, protocol)
+				}
+			}
+			visit(step.Steps)
+		}
+	}
+	visit(s.Steps)
+	return protocols
+}
+
+// Title is the name of the step, or the type if it has no name
+func (s Step) Title() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Type
+}
+
+// Packets is the number of packets sent by a send step
+func (s Step) Packets() int {
+	if s.Count == 0 {
+		return 1
+	}
+	return s.Count
+}
+
+// Payload returns the payload of a send step, "hi" unless a size is set
+func (s Step) Payload() []byte {
+	if s.Size == 0 {
+		return []byte("hi")
+	}
+	payload := make([]byte, s.Size)
+	for i := range payload {
+		payload[i] = byte('a' + i%26)
+	}
+	return payload
+}
+
+// SendFlag returns the send flag of a send step. The default is release after
+// the message for send steps and release after the reply for send-and-receive
+// steps.
+func (s Step) SendFlag() devicefamily.SendFlag {
+	if s.Flag == "" {
+		if s.Type == SendAndReceive {
+			return devicefamily.SendFlagReleaseAfterNextReply
+		}
+		return devicefamily.SendFlagReleaseAfterNextMessage
+	}
+	flag, _ := ParseSendFlag(s.Flag)
+	return flag
+}
+
+// ParseSendFlag parses a send flag: none, high-priority,
+// release-after-message or release-after-reply
+func ParseSendFlag(flag string) (devicefamily.SendFlag, error) {
+	switch flag {
+	case "none":
+		return devicefamily.SendFlagNone, nil
+	case "high-priority":
+		return devicefamily.SendFlagHighPriority, nil
+	case "release-after-message":
+		return devicefamily.SendFlagReleaseAfterNextMessage, nil
+	case "release-after-reply":
+		return devicefamily.SendFlagReleaseAfterNextReply, nil
+	}
+	return devicefamily.SendFlagNone, fmt.Errorf("unknown send flag %q", flag)
+}
@@ -0,0 +1,177 @@
+package scenario
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ExploratoryEngineering/labdevicetester/pkg/devicefamily"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestValidate(t *testing.T) {
+	record := func(steps ...Step) Step {
+		return Step{Type: Record, Duration: seconds(10), Steps: steps}
+	}
+	tests := []struct {
+		name  string
+		steps []Step
+		err   string
+	}{
+		{"valid", []Step{
+			{Type: Configure, Reboot: true, EDRX: &EDRX{Enabled: true, Cycle: 0x0f}, Radio: "airplane"},
+			{Type: WaitForRegistration},
+			record(Step{Type: Send, Protocol: "tcp", Count: 3, Size: 10, Flag: "none", LastFlag: "release-after-message"}),
+			{Type: Assert, Metric: "energy_j", Max: float(1)},
+		}, ""},
+		{"no steps", nil, "no steps"},
+		{"unknown type", []Step{{Type: "jump"}}, "unknown step type"},
+		{"nested recording", []Step{record(record())}, "can't be nested"},
+		{"recording without duration", []Step{{Type: Record}}, "missing duration"},
+		{"sleep without duration", []Step{{Type: Sleep}}, "missing duration"},
+		{"tcp send and receive", []Step{{Type: SendAndReceive, Protocol: "tcp"}}, "unsupported protocol"},
+		{"unknown protocol", []Step{{Type: Send, Protocol: "sctp"}}, "unsupported protocol"},
+		{"negative count", []Step{{Type: Send, Count: -1}}, "negative"},
+		{"unknown flag", []Step{{Type: Send, Flag: "release"}}, "unknown send flag"},
+		{"unknown last flag", []Step{{Type: Send, LastFlag: "release"}}, "unknown send flag"},
+		{"eDRX cycle", []Step{{Type: Configure, EDRX: &EDRX{Enabled: true, Cycle: 0x10}}}, "4 bits"},
+		{"unknown radio", []Step{{Type: Configure, Radio: "rx-only"}}, "unknown radio"},
+		{"assert without metric", []Step{{Type: Assert, Max: float(1)}}, "missing metric"},
+		{"assert without limits", []Step{{Type: Assert, Metric: "energy_j"}}, "missing min or max"},
+	}
+	for _, tt := range tests {
+		err := Scenario{Name: "test", Steps: tt.steps}.Validate()
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+	if err := (Scenario{Steps: []Step{{Type: Resolve}}}).Validate(); err == nil {
+		t.Error("scenario without a name is valid")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scenario")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	s, err := Load(write("ok.json", `{
+		"name": "sendreceive",
+		"steps": [
+			{"type": "configure", "reboot": true, "psm": {"enabled": true, "tau": 223, "active_time": 1}},
+			{"type": "record", "duration": "1m30s", "steps": [
+				{"type": "send-and-receive", "count": 3, "interval": "500ms"}
+			]}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Steps[0].PSM == nil || s.Steps[0].PSM.TAU != 223 || s.Steps[1].Duration.Duration != 90*time.Second ||
+		s.Steps[1].Steps[0].Interval.Duration != 500*time.Millisecond {
+		t.Errorf("Load() = %+v", s)
+	}
+
+	for name, content := range map[string]string{
+		"unknown.json":  `{"name": "x", "steps": [{"type": "sleep", "duration": "1s", "color": "red"}]}`,
+		"duration.json": `{"name": "x", "steps": [{"type": "sleep", "duration": 10}]}`,
+		"invalid.json":  `{"name": "x", "steps": [{"type": "sleep"}]}`,
+		"syntax.json":   `{"name": "x",`,
+	} {
+		if _, err := Load(write(name, content)); err == nil {
+			t.Errorf("Load(%s) succeeded", name)
+		}
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	buf, err := json.Marshal(seconds(90))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"1m30s"`; string(buf) != want {
+		t.Errorf("Marshal() = %s, want %s", buf, want)
+	}
+	var d Duration
+	if err := json.Unmarshal(buf, &d); err != nil || d.Duration != 90*time.Second {
+		t.Errorf("Unmarshal() = %v, %v", d, err)
+	}
+	for _, invalid := range []string{`90`, `"90"`, `"soon"`} {
+		if err := json.Unmarshal([]byte(invalid), &d); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded", invalid)
+		}
+	}
+}
+
+func TestStepDefaults(t *testing.T) {
+	tests := []struct {
+		step    Step
+		packets int
+		payload string
+		flag    devicefamily.SendFlag
+	}{
+		{Step{Type: Send}, 1, "hi", devicefamily.SendFlagReleaseAfterNextMessage},
+		{Step{Type: SendAndReceive}, 1, "hi", devicefamily.SendFlagReleaseAfterNextReply},
+		{Step{Type: Send, Count: 3, Size: 30, Flag: "high-priority"}, 3, "abcdefghijklmnopqrstuvwxyzabcd", devicefamily.SendFlagHighPriority},
+		{Step{Type: SendAndReceive, Flag: "none"}, 1, "hi", devicefamily.SendFlagNone},
+	}
+	for _, tt := range tests {
+		if got := tt.step.Packets(); got != tt.packets {
+			t.Errorf("%+v: Packets() = %d, want %d", tt.step, got, tt.packets)
+		}
+		if got := string(tt.step.Payload()); got != tt.payload {
+			t.Errorf("%+v: Payload() = %q, want %q", tt.step, got, tt.payload)
+		}
+		if got := tt.step.SendFlag(); got != tt.flag {
+			t.Errorf("%+v: SendFlag() = %#x, want %#x", tt.step, got, tt.flag)
+		}
+	}
+}
+
+func TestProtocols(t *testing.T) {
+	s := Scenario{Steps: []Step{
+		{Type: Send},
+		{Type: Record, Steps: []Step{{Type: Send, Protocol: "tcp"}, {Type: SendAndReceive}}},
+	}}
+	if got := s.Protocols(); len(got) != 2 || got[0] != "udp" || got[1] != "tcp" {
+		t.Errorf("Protocols() = %v, want [udp tcp]", got)
+	}
+	if got := (Scenario{Steps: []Step{{Type: Configure}}}).Protocols(); len(got) != 0 {
+		t.Errorf("Protocols() = %v, want none", got)
+	}
+}
+
+func TestWithoutReboot(t *testing.T) {
+	base := Builtin["send"]
+	s := base.WithoutReboot()
+	for _, step := range s.Steps {
+		if step.Reboot {
+			t.Errorf("step %s reboots", step.Title())
+		}
+	}
+	if !base.Steps[0].Reboot || !Builtin["send"].Steps[0].Reboot {
+		t.Error("WithoutReboot() modified the scenario")
+	}
+	if len(s.Steps[3].Steps) != len(base.Steps[3].Steps) || s.Steps[0].PSM != base.Steps[0].PSM {
+		t.Errorf("WithoutReboot() = %+v", s)
+	}
+}
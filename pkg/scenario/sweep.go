@@ -0,0 +1,196 @@
+package scenario
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Sweep is a matrix of step parameters. The scenario is run once for every
+// combination of the values, see Variants. Parameters without values are
+// left as they are in the scenario.
+type Sweep struct {
+	// PSM and EDRX replace the configuration of the configure steps
+	PSM  []PSM  `json:"psm,omitempty"`
+	EDRX []EDRX `json:"edrx,omitempty"`
+	// Size, Flag and Count replace the parameters of the send steps
+	Size  []int    `json:"size,omitempty"`
+	Flag  []string `json:"flag,omitempty"`
+	Count []int    `json:"count,omitempty"`
+}
+
+// Variant is a scenario with one combination of the sweep parameters
+type Variant struct {
+	// Parameters describes the combination, e.g. "edrx=off size=64"
+	Parameters string
+	Scenario   Scenario
+}
+
+// LoadSweep reads a sweep from a JSON file
+func LoadSweep(filename string) (Sweep, error) {
+	var s Sweep
+	f, err := os.Open(filename)
+	if err != nil {
+		return s, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return s, err
+	}
+	return s, s.Validate()
+}
+
+// Validate checks the parameter values
+func (s Sweep) Validate() error {
+	if len(s.dimensions()) == 0 {
+		return errors.New("sweep has no parameters")
+	}
+	for _, e := range s.EDRX {
+		if e.Cycle > 0x0f {
+			return errors.New("eDRX cycle must be 4 bits")
+		}
+	}
+	for _, size := range s.Size {
+		if size <= 0 {
+			return fmt.Errorf("invalid size %d", size)
+		}
+	}
+	for _, flag := range s.Flag {
+		if _, err := ParseSendFlag(flag); err != nil {
+			return err
+		}
+	}
+	for _, count := range s.Count {
+		if count <= 0 {
+			return fmt.Errorf("invalid count %d", count)
+		}
+	}
+	return nil
+}
+
+// option is one value of a sweep parameter
+type option struct {
+	label string
+	apply func(step *Step)
+}
+
+func (s Sweep) dimensions() [][]option {
+	var dims [][]option
+	add := func(opts []option) {
+		if len(opts) > 0 {
+			dims = append(dims, opts)
+		}
+	}
+
+	var opts []option
+	for _, p := range s.PSM {
+		p := p
+		label := "psm=off"
+		if p.Enabled {
+			label = fmt.Sprintf("t3412=%08b t3324=%08b", p.TAU, p.ActiveTime)
+		}
+		opts = append(opts, option{label, func(step *Step) {
+			if step.Type == Configure {
+				step.PSM = &p
+			}
+		}})
+	}
+	add(opts)
+
+	opts = nil
+	for _, e := range s.EDRX {
+		e := e
+		label := "edrx=off"
+		if e.Enabled {
+			label = fmt.Sprintf("edrx=%04b", e.Cycle)
+		}
+		opts = append(opts, option{label, func(step *Step) {
+			if step.Type == Configure {
+				step.EDRX = &e
+			}
+		}})
+	}
+	add(opts)
+
+	opts = nil
+	for _, size := range s.Size {
+		size := size
+		opts = append(opts, option{fmt.Sprintf("size=%d", size), func(step *Step) {
+			if step.Type == Send || step.Type == SendAndReceive {
+				step.Size = size
+			}
+		}})
+	}
+	add(opts)
+
+	opts = nil
+	for _, flag := range s.Flag {
+		flag := flag
+		opts = append(opts, option{"flag=" + flag, func(step *Step) {
+			if step.Type == Send || step.Type == SendAndReceive {
+				step.Flag = flag
+			}
+		}})
+	}
+	add(opts)
+
+	opts = nil
+	for _, count := range s.Count {
+		count := count
+		opts = append(opts, option{fmt.Sprintf("count=%d", count), func(step *Step) {
+			if step.Type == Send || step.Type == SendAndReceive {
+				step.Count = count
+			}
+		}})
+	}
+	add(opts)
+	return dims
+}
+
+// Variants returns base with every combination of the parameters. The
+// variants are named after base with their number, e.g. send-3, so that
+// their captures and results can be told apart.
+func (s Sweep) Variants(base Scenario) []Variant {
+	combinations := [][]option{nil}
+	for _, dim := range s.dimensions() {
+		var next [][]option
+		for _, c := range combinations {
+			for _, o := range dim {
+				next = append(next, append(append([]option(nil), c...), o))
+			}
+		}
+		combinations = next
+	}
+
+	var variants []Variant
+	for i, c := range combinations {
+		v := base
+		v.Name = fmt.Sprintf("%s-%d", base.Name, i+1)
+		var labels []string
+		for _, o := range c {
+			labels = append(labels, o.label)
+		}
+		v.Steps = applyOptions(base.Steps, c)
+		variants = append(variants, Variant{Parameters: strings.Join(labels, " "), Scenario: v})
+	}
+	return variants
+}
+
+func applyOptions(steps []Step, opts []option) []Step {
+	if steps == nil {
+		return nil
+	}
+	copied := make([]Step, len(steps))
+	for i, step := range steps {
+		for _, o := range opts {
+			o.apply(&step)
+		}
+		step.Steps = applyOptions(step.Steps, opts)
+		copied[i] = step
+	}
+	return copied
+}
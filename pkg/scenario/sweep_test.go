@@ -0,0 +1,119 @@
+package scenario
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVariants(t *testing.T) {
+	base := Builtin["send"]
+	s := Sweep{
+		EDRX: []EDRX{{}, {Enabled: true, Cycle: 5}},
+		Size: []int{16, 64, 256},
+		Flag: []string{"release-after-message"},
+	}
+	variants := s.Variants(base)
+	wantParameters := []string{
+		"edrx=off size=16 flag=release-after-message",
+		"edrx=off size=64 flag=release-after-message",
+		"edrx=off size=256 flag=release-after-message",
+		"edrx=0101 size=16 flag=release-after-message",
+		"edrx=0101 size=64 flag=release-after-message",
+		"edrx=0101 size=256 flag=release-after-message",
+	}
+	if len(variants) != len(wantParameters) {
+		t.Fatalf("%d variants, want %d", len(variants), len(wantParameters))
+	}
+	for i, v := range variants {
+		if v.Parameters != wantParameters[i] {
+			t.Errorf("variant %d: parameters %q, want %q", i+1, v.Parameters, wantParameters[i])
+		}
+		if want := "send-" + string(rune('1'+i)); v.Scenario.Name != want {
+			t.Errorf("variant %d: named %s, want %s", i+1, v.Scenario.Name, want)
+		}
+		if err := v.Scenario.Validate(); err != nil {
+			t.Errorf("variant %d: %v", i+1, err)
+		}
+	}
+
+	// The options are applied to the nested steps of the right type
+	v := variants[4].Scenario
+	configure := v.Steps[0]
+	if configure.EDRX == nil || *configure.EDRX != (EDRX{Enabled: true, Cycle: 5}) || configure.Size != 0 {
+		t.Errorf("configure step %+v", configure)
+	}
+	send := v.Steps[3].Steps[1]
+	if send.Type != Send || send.Size != 64 || send.Flag != "release-after-message" || send.EDRX != nil {
+		t.Errorf("send step %+v", send)
+	}
+
+	// The base scenario is left as it was
+	if !reflect.DeepEqual(base, Builtin["send"]) || base.Steps[3].Steps[1].Size != 0 || base.Steps[0].EDRX != nil {
+		t.Error("Variants() modified the base scenario")
+	}
+}
+
+func TestVariantsPSM(t *testing.T) {
+	s := Sweep{PSM: []PSM{{}, {Enabled: true, TAU: 0xa2, ActiveTime: 1}}, Count: []int{1}}
+	variants := s.Variants(Builtin["burst"])
+	want := []string{"psm=off count=1", "t3412=10100010 t3324=00000001 count=1"}
+	for i, v := range variants {
+		if v.Parameters != want[i] {
+			t.Errorf("variant %d: parameters %q, want %q", i+1, v.Parameters, want[i])
+		}
+		if p := v.Scenario.Steps[0].PSM; p == nil || p.Enabled != (i == 1) {
+			t.Errorf("variant %d: PSM %+v", i+1, p)
+		}
+		if c := v.Scenario.Steps[3].Steps[3].Count; c != 1 {
+			t.Errorf("variant %d: count %d, want 1", i+1, c)
+		}
+	}
+	// Each variant has its own PSM configuration
+	if variants[0].Scenario.Steps[0].PSM == variants[1].Scenario.Steps[0].PSM {
+		t.Error("variants share the PSM configuration")
+	}
+}
+
+func TestSweepValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		sweep Sweep
+		err   string
+	}{
+		{"valid", Sweep{Size: []int{1}, Count: []int{2}}, ""},
+		{"empty", Sweep{}, "no parameters"},
+		{"cycle", Sweep{EDRX: []EDRX{{Enabled: true, Cycle: 0x10}}}, "4 bits"},
+		{"size", Sweep{Size: []int{0}}, "invalid size"},
+		{"flag", Sweep{Flag: []string{"sometimes"}}, "sometimes"},
+		{"count", Sweep{Count: []int{-1}}, "invalid count"},
+	}
+	for _, tt := range tests {
+		err := tt.sweep.Validate()
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestApplyOptions(t *testing.T) {
+	if applyOptions(nil, nil) != nil {
+		t.Error("applyOptions() of no steps isn't nil")
+	}
+	steps := []Step{{Type: Sleep}, {Type: Record, Steps: []Step{{Type: SendAndReceive}}}}
+	size := option{"size=8", func(step *Step) {
+		if step.Type == SendAndReceive {
+			step.Size = 8
+		}
+	}}
+	got := applyOptions(steps, []option{size})
+	if got[1].Steps[0].Size != 8 || steps[1].Steps[0].Size != 0 || got[1].Steps[0].Type != SendAndReceive {
+		t.Errorf("applyOptions() = %+v", got)
+	}
+	if got[0].Size != 0 || got[0].Steps != nil {
+		t.Errorf("applyOptions() changed %+v", got[0])
+	}
+}
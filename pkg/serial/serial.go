@@ -3,7 +3,9 @@ package serial
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"strings"
 	"time"
@@ -11,57 +13,147 @@ import (
 	"github.com/tarm/serial"
 )
 
+// ReadTimeout is the time to wait for a response to a command
+const ReadTimeout = 30 * time.Second
+
 // SerialConnection is a serial connection
 type SerialConnection struct {
-	serialPort *serial.Port
-	scanner    *bufio.Scanner
-	verbose    bool
+	config      serial.Config
+	serialPort  io.ReadWriteCloser
+	scanner     *bufio.Scanner
+	verbose     bool
+	urcHandlers map[string]func(string)
+	timeline    *Timeline
+	// timedOut is set when the device didn't respond to the last command
+	timedOut bool
 }
 
 // NewSerialConnection creates a new SerialConnection
 func NewSerialConnection(device string, baud int, verbose bool) (*SerialConnection, error) {
-	c := &serial.Config{Name: device, Baud: baud, ReadTimeout: time.Second * 30}
-	s, err := serial.OpenPort(c)
+	c := serial.Config{Name: device, Baud: baud, ReadTimeout: ReadTimeout}
+	s, err := serial.OpenPort(&c)
 	if err != nil {
 		return nil, err
 	}
 
-	// Wrap serial connection in scanner
-	scanner := bufio.NewScanner(s)
-	scanner.Split(scanCRLF)
+	conn := &SerialConnection{
+		config:      c,
+		serialPort:  s,
+		verbose:     verbose,
+		urcHandlers: make(map[string]func(string)),
+	}
+	conn.resetScanner()
+	return conn, nil
+}
+
+// NewPortConnection creates a SerialConnection on a port that is already open,
+// e.g. a fake device in tests. The read timeout of the port can't be changed.
+func NewPortConnection(port io.ReadWriteCloser, verbose bool) *SerialConnection {
+	conn := &SerialConnection{
+		serialPort:  port,
+		verbose:     verbose,
+		urcHandlers: make(map[string]func(string)),
+	}
+	conn.resetScanner()
+	return conn
+}
+
+// resetScanner wraps the serial connection in a new scanner. A read timeout
+// ends the scanner, so it has to be replaced before reading again.
+func (s *SerialConnection) resetScanner() {
+	s.scanner = bufio.NewScanner(s.serialPort)
+	s.scanner.Split(scanCRLF)
+}
 
-	return &SerialConnection{
-		serialPort: s,
-		scanner:    scanner,
-		verbose:    verbose,
-	}, nil
+// SetReadTimeout reopens the port with a new read timeout, e.g. a short one
+// to poll a module that is booting. The timeout can only be set when the
+// port is opened.
+func (s *SerialConnection) SetReadTimeout(timeout time.Duration) error {
+	if timeout == s.config.ReadTimeout {
+		return nil
+	}
+	if s.config.Name == "" {
+		return errors.New("the read timeout can't be changed")
+	}
+	s.serialPort.Close()
+	s.config.ReadTimeout = timeout
+	p, err := serial.OpenPort(&s.config)
+	if err != nil {
+		return err
+	}
+	s.serialPort = p
+	s.resetScanner()
+	return nil
+}
+
+// TimedOut returns true if the device didn't respond to the last command or
+// the URC waited for didn't arrive, e.g. because it has hung
+func (s *SerialConnection) TimedOut() bool {
+	return s.timedOut
+}
+
+// HandleURC registers a handler that is called with every received line
+// starting with prefix, regardless of which command is running when it
+// arrives
+func (s *SerialConnection) HandleURC(prefix string, handler func(line string)) {
+	s.urcHandlers[prefix] = handler
+}
+
+// SetTimeline makes the connection record every line sent and received
+func (s *SerialConnection) SetTimeline(t *Timeline) {
+	s.timeline = t
+}
+
+func (s *SerialConnection) dispatchURC(line string) {
+	for prefix, handler := range s.urcHandlers {
+		if strings.HasPrefix(line, prefix) {
+			handler(line)
+		}
+	}
 }
 
 // SendAndReceive sends and recieves data, both regular commands and URCs
 func (s *SerialConnection) SendAndReceive(cmd string) ([]string, []string, error) {
+	return s.sendAndReceive(cmd, cmd)
+}
+
+// SendAndReceiveRedacted sends a command with a secret, e.g. a password. The
+// command and its echo are logged and added to the timeline as redacted.
+func (s *SerialConnection) SendAndReceiveRedacted(cmd, redacted string) ([]string, []string, error) {
+	return s.sendAndReceive(cmd, redacted)
+}
+
+func (s *SerialConnection) sendAndReceive(cmd, logged string) ([]string, []string, error) {
+	s.timedOut = false
 	if s.verbose {
-		log.Printf("--> %s", cmd)
+		log.Printf("--> %s", logged)
 	}
 
+	s.timeline.add(Command, logged)
 	_, err := s.serialPort.Write([]byte(cmd + "\r\n"))
 	if err != nil {
 		return nil, nil, err
 	}
 
-	return s.scanResponse(s.scanner)
+	return s.scanResponse(s.scanner, strings.NewReplacer(cmd, logged))
 }
 
 func (s *SerialConnection) WaitForURC(urc string) (string, error) {
+	s.timedOut = false
 	for s.scanner.Scan() {
 		line := s.scanner.Text()
 		if s.verbose && line != "" {
 			log.Printf("<-- %s", line)
 		}
+		s.timeline.add(Response, line)
+		s.dispatchURC(line)
 
 		if strings.HasPrefix(line, urc) {
 			return line, nil
 		}
 	}
+	s.resetScanner()
+	s.timedOut = true
 	return "", fmt.Errorf("Error: serial closed")
 }
 
@@ -87,17 +179,24 @@ func (s *SerialConnection) splitURCResponse(cmds []string, err error) ([]string,
 	return data, urcs, err
 }
 
-func (s *SerialConnection) scanResponse(scanner *bufio.Scanner) ([]string, []string, error) {
+func (s *SerialConnection) scanResponse(scanner *bufio.Scanner, redact *strings.Replacer) ([]string, []string, error) {
 	var data []string
 
 	for s.scanner.Scan() {
-		line := scanner.Text()
+		line := redact.Replace(scanner.Text())
 		if s.verbose && line != "" {
 			log.Printf("<-- %s", line)
 		}
+		s.timeline.add(Response, line)
+		s.dispatchURC(line)
 
 		if line == "OK" {
-			return s.splitURCResponse(data[1:], nil)
+			// The first line is the echo of the command, unless the OK is
+			// a late response to an earlier command
+			if len(data) > 0 {
+				data = data[1:]
+			}
+			return s.splitURCResponse(data, nil)
 		}
 
 		if strings.Contains(line, "ERROR") {
@@ -110,6 +209,8 @@ func (s *SerialConnection) scanResponse(scanner *bufio.Scanner) ([]string, []str
 		data = append(data, line)
 	}
 
+	s.resetScanner()
+	s.timedOut = true
 	return s.splitURCResponse(data, fmt.Errorf("Invalid response: '%v'", data))
 }
 
@@ -0,0 +1,81 @@
+package serial
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakePort is a serial port that replies with canned input and records what
+// is written to it. A read past the input returns EOF like a read timeout.
+type fakePort struct {
+	input   *strings.Reader
+	written bytes.Buffer
+}
+
+func (p *fakePort) Read(b []byte) (int, error)  { return p.input.Read(b) }
+func (p *fakePort) Write(b []byte) (int, error) { return p.written.Write(b) }
+func (p *fakePort) Close() error                { return nil }
+
+func newFakeConnection(input string) (*SerialConnection, *fakePort) {
+	p := &fakePort{input: strings.NewReader(input)}
+	return NewPortConnection(p, false), p
+}
+
+func TestSendAndReceive(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		data     []string
+		urcs     []string
+		err      bool
+		timedOut bool
+	}{
+		{"ok", "AT\r\r\nOK\r\n", nil, nil, false, false},
+		{"data", "AT+CGSN=1\r\r\n+CGSN: 357517080229471\r\n\r\nOK\r\n", nil, []string{"+CGSN: 357517080229471"}, false, false},
+		{"plain data", "AT+CIMI\r\r\n242016000003018\r\n\r\nOK\r\n", []string{"242016000003018"}, nil, false, false},
+		{"stale ok", "OK\r\n", nil, nil, false, false},
+		{"error", "AT\r\r\nERROR\r\n", []string{"AT"}, nil, true, false},
+		{"timeout", "AT\r\r\n", []string{"AT"}, nil, true, true},
+		{"no response", "", nil, nil, true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, p := newFakeConnection(test.input)
+			data, urcs, err := s.SendAndReceive("AT")
+			if (err != nil) != test.err {
+				t.Fatalf("error = %v, want error %v", err, test.err)
+			}
+			if !reflect.DeepEqual(data, test.data) {
+				t.Errorf("data = %q, want %q", data, test.data)
+			}
+			if !reflect.DeepEqual(urcs, test.urcs) {
+				t.Errorf("urcs = %q, want %q", urcs, test.urcs)
+			}
+			if s.TimedOut() != test.timedOut {
+				t.Errorf("TimedOut() = %v, want %v", s.TimedOut(), test.timedOut)
+			}
+			if got := p.written.String(); got != "AT\r\n" {
+				t.Errorf("written = %q, want %q", got, "AT\r\n")
+			}
+		})
+	}
+}
+
+func TestSendAndReceiveRedacted(t *testing.T) {
+	s, p := newFakeConnection("AT+UAUTH=1,\"secret\"\r\r\nOK\r\n")
+	timeline := NewTimeline()
+	s.SetTimeline(timeline)
+	if _, _, err := s.SendAndReceiveRedacted(`AT+UAUTH=1,"secret"`, `AT+UAUTH=1,"***"`); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.written.String(); got != "AT+UAUTH=1,\"secret\"\r\n" {
+		t.Errorf("written = %q", got)
+	}
+	for _, e := range timeline.Events() {
+		if strings.Contains(e.Line, "secret") {
+			t.Errorf("timeline has the secret: %q", e.Line)
+		}
+	}
+}
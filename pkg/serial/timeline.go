@@ -0,0 +1,64 @@
+package serial
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Direction of a line on the serial connection
+const (
+	Command  = "command"
+	Response = "response"
+	URC      = "urc"
+)
+
+// Event is a line sent or received on the serial connection
+type Event struct {
+	// Time includes the monotonic clock reading, use Sub on two events for
+	// high-resolution intervals
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Line      string    `json:"line"`
+}
+
+// Timeline records the lines on a serial connection with timestamps
+type Timeline struct {
+	mutex  sync.Mutex
+	events []Event
+}
+
+// NewTimeline creates an empty timeline
+func NewTimeline() *Timeline {
+	return &Timeline{}
+}
+
+// Events returns the recorded events
+func (t *Timeline) Events() []Event {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]Event(nil), t.events...)
+}
+
+// Since returns the events recorded at or after start
+func (t *Timeline) Since(start time.Time) []Event {
+	var events []Event
+	for _, e := range t.Events() {
+		if !e.Time.Before(start) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func (t *Timeline) add(direction, line string) {
+	if t == nil || line == "" {
+		return
+	}
+	if direction == Response && strings.HasPrefix(line, "+") {
+		direction = URC
+	}
+	t.mutex.Lock()
+	t.events = append(t.events, Event{Time: time.Now(), Direction: direction, Line: line})
+	t.mutex.Unlock()
+}
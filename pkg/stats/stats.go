@@ -0,0 +1,70 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+)
+
+// Summary is a statistical summary of a sample
+type Summary struct {
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	// CILow and CIHigh are the 95% confidence interval of the mean
+	CILow  float64 `json:"ci95_low"`
+	CIHigh float64 `json:"ci95_high"`
+}
+
+// Summarize computes the summary of values. The standard deviation is the
+// sample standard deviation and the confidence interval uses Student's t
+// distribution, since the number of runs is usually small.
+func Summarize(values []float64) Summary {
+	s := Summary{N: len(values)}
+	if s.N == 0 {
+		return s
+	}
+	s.Min, s.Max = values[0], values[0]
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+		s.Min = math.Min(s.Min, v)
+		s.Max = math.Max(s.Max, v)
+	}
+	s.Mean = sum / float64(s.N)
+	s.CILow, s.CIHigh = s.Mean, s.Mean
+	if s.N < 2 {
+		return s
+	}
+	squares := 0.0
+	for _, v := range values {
+		squares += (v - s.Mean) * (v - s.Mean)
+	}
+	s.StdDev = math.Sqrt(squares / float64(s.N-1))
+	margin := t95(s.N-1) * s.StdDev / math.Sqrt(float64(s.N))
+	s.CILow, s.CIHigh = s.Mean-margin, s.Mean+margin
+	return s
+}
+
+// tTable is the two-sided 95% critical value of Student's t distribution for
+// 1 to 30 degrees of freedom
+var tTable = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+func t95(df int) float64 {
+	if df <= len(tTable) {
+		return tTable[df-1]
+	}
+	return 1.96
+}
+
+// Format formats the summary with format for the values, e.g. "%.4f J"
+func (s Summary) Format(format string) string {
+	f := func(v float64) string { return fmt.Sprintf(format, v) }
+	return fmt.Sprintf("n=%d mean %s sd %s min %s max %s 95%% CI [%s, %s]",
+		s.N, f(s.Mean), f(s.StdDev), f(s.Min), f(s.Max), f(s.CILow), f(s.CIHigh))
+}
@@ -0,0 +1,68 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-4
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   Summary
+	}{
+		{"empty", nil, Summary{}},
+		{"one", []float64{2.5}, Summary{N: 1, Mean: 2.5, Min: 2.5, Max: 2.5, CILow: 2.5, CIHigh: 2.5}},
+		{"two", []float64{1, 3}, Summary{N: 2, Mean: 2, StdDev: math.Sqrt2, Min: 1, Max: 3, CILow: 2 - 12.706, CIHigh: 2 + 12.706}},
+		{"five", []float64{5, 1, 4, 2, 3}, Summary{N: 5, Mean: 3, StdDev: 1.5811, Min: 1, Max: 5, CILow: 3 - 1.9630, CIHigh: 3 + 1.9630}},
+		{"constant", []float64{7, 7, 7}, Summary{N: 3, Mean: 7, Min: 7, Max: 7, CILow: 7, CIHigh: 7}},
+	}
+	for _, tt := range tests {
+		s := Summarize(tt.values)
+		if s.N != tt.want.N || !near(s.Mean, tt.want.Mean) || !near(s.StdDev, tt.want.StdDev) || s.Min != tt.want.Min || s.Max != tt.want.Max ||
+			!near(s.CILow, tt.want.CILow) || !near(s.CIHigh, tt.want.CIHigh) {
+			t.Errorf("%s: Summarize() = %+v, want %+v", tt.name, s, tt.want)
+		}
+	}
+}
+
+func TestT95(t *testing.T) {
+	tests := []struct {
+		df   int
+		want float64
+	}{
+		{1, 12.706},
+		{4, 2.776},
+		{30, 2.042},
+		// The normal distribution is close enough from here on
+		{31, 1.96},
+		{1000, 1.96},
+	}
+	for _, tt := range tests {
+		if got := t95(tt.df); got != tt.want {
+			t.Errorf("t95(%d) = %g, want %g", tt.df, got, tt.want)
+		}
+	}
+
+	// The interval of a large sample uses the normal distribution
+	values := make([]float64, 100)
+	for i := range values {
+		values[i] = float64(i % 2)
+	}
+	s := Summarize(values)
+	if margin := 1.96 * s.StdDev / 10; !near(s.CIHigh-s.Mean, margin) {
+		t.Errorf("margin %g, want %g", s.CIHigh-s.Mean, margin)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	s := Summary{N: 2, Mean: 1.5, StdDev: 0.5, Min: 1, Max: 2, CILow: 0.25, CIHigh: 2.75}
+	want := "n=2 mean 1.50 J sd 0.50 J min 1.00 J max 2.00 J 95% CI [0.25 J, 2.75 J]"
+	if got := s.Format("%.2f J"); got != want {
+		t.Errorf("Format() = %q, want %q", got, want)
+	}
+}